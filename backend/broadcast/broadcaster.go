@@ -0,0 +1,32 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Handler receives every payload published on any topic.
+type Handler func(topic string, payload []byte)
+
+// Broadcaster fans a payload out to every backend instance, including the
+// one that published it. Payloads must be JSON documents.
+type Broadcaster interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	Subscribe(handler Handler)
+	Close() error
+}
+
+// NewFromEnv builds the broadcaster named by CHAT_BROADCASTER. The in-memory
+// one only reaches sockets on this instance, so replicated deployments need
+// postgres.
+func NewFromEnv(dsn string) (Broadcaster, error) {
+	switch name := os.Getenv("CHAT_BROADCASTER"); name {
+	case "", "memory":
+		return NewMemory(), nil
+	case "postgres":
+		return NewPostgres(context.Background(), dsn)
+	default:
+		return nil, fmt.Errorf("unknown chat broadcaster %q", name)
+	}
+}
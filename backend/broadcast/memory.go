@@ -0,0 +1,36 @@
+package broadcast
+
+import (
+	"context"
+	"sync"
+)
+
+type Memory struct {
+	mutex    sync.RWMutex
+	handlers []Handler
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Publish(ctx context.Context, topic string, payload []byte) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, handler := range m.handlers {
+		handler(topic, payload)
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(handler Handler) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.handlers = append(m.handlers, handler)
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
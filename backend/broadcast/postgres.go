@@ -0,0 +1,175 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const postgresChannel = "shopsphere_broadcast"
+
+// NOTIFY payloads must stay under 8000 bytes. Larger payloads are parked in
+// an unlogged table and the notification carries only the row ID.
+const maxNotifyPayload = 7000
+
+const spilledPayloadTTL = 5 * time.Minute
+
+type notification struct {
+	Topic   string          `json:"t"`
+	Payload json.RawMessage `json:"p,omitempty"`
+	Ref     int64           `json:"r,omitempty"`
+}
+
+// Postgres publishes with NOTIFY and keeps one dedicated connection LISTENing,
+// so every instance connected to the same database sees every payload.
+type Postgres struct {
+	dsn    string
+	pool   *pgxpool.Pool
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mutex    sync.RWMutex
+	handlers []Handler
+}
+
+func NewPostgres(ctx context.Context, dsn string) (*Postgres, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := pool.Exec(ctx, `CREATE UNLOGGED TABLE IF NOT EXISTS broadcast_payloads (
+		id bigserial PRIMARY KEY,
+		payload text NOT NULL,
+		created_at timestamptz NOT NULL DEFAULT now()
+	)`); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	listenCtx, cancel := context.WithCancel(context.Background())
+	p := &Postgres{
+		dsn:    dsn,
+		pool:   pool,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go p.listen(listenCtx)
+
+	return p, nil
+}
+
+func (p *Postgres) Publish(ctx context.Context, topic string, payload []byte) error {
+	n := notification{Topic: topic, Payload: payload}
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	if len(data) > maxNotifyPayload {
+		if err := p.pool.QueryRow(ctx, "INSERT INTO broadcast_payloads (payload) VALUES ($1) RETURNING id", string(payload)).Scan(&n.Ref); err != nil {
+			return err
+		}
+		if _, err := p.pool.Exec(ctx, "DELETE FROM broadcast_payloads WHERE created_at < $1", time.Now().Add(-spilledPayloadTTL)); err != nil {
+			log.Printf("Failed to prune spilled broadcast payloads: %v", err)
+		}
+
+		n.Payload = nil
+		if data, err = json.Marshal(n); err != nil {
+			return err
+		}
+	}
+
+	_, err = p.pool.Exec(ctx, "SELECT pg_notify($1, $2)", postgresChannel, string(data))
+	return err
+}
+
+func (p *Postgres) Subscribe(handler Handler) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.handlers = append(p.handlers, handler)
+}
+
+func (p *Postgres) Close() error {
+	p.cancel()
+	<-p.done
+	p.pool.Close()
+	return nil
+}
+
+// listen holds the LISTEN connection open, reconnecting with backoff when it
+// drops. Payloads published while disconnected are lost; clients recover them
+// from the REST history.
+func (p *Postgres) listen(ctx context.Context) {
+	defer close(p.done)
+
+	backoff := time.Second
+	for {
+		err := p.listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Broadcast listener disconnected, retrying in %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (p *Postgres) listenOnce(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, p.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+postgresChannel); err != nil {
+		return err
+	}
+
+	for {
+		pgNotification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var n notification
+		if err := json.Unmarshal([]byte(pgNotification.Payload), &n); err != nil {
+			log.Printf("Ignoring malformed broadcast notification: %v", err)
+			continue
+		}
+
+		payload := []byte(n.Payload)
+		if n.Ref != 0 {
+			var spilled string
+			if err := p.pool.QueryRow(ctx, "SELECT payload FROM broadcast_payloads WHERE id = $1", n.Ref).Scan(&spilled); err != nil {
+				log.Printf("Failed to load spilled broadcast payload %d: %v", n.Ref, err)
+				continue
+			}
+			payload = []byte(spilled)
+		}
+
+		p.dispatch(n.Topic, payload)
+	}
+}
+
+func (p *Postgres) dispatch(topic string, payload []byte) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	for _, handler := range p.handlers {
+		handler(topic, payload)
+	}
+}
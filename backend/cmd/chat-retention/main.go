@@ -0,0 +1,58 @@
+// Command chat-retention runs one chat retention pass by hand. With -dry-run
+// it only prints, as JSON, what the pass would archive and purge.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/handlers"
+	"shopsphere-backend/storage"
+
+	"gorm.io/gorm/logger"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would be purged without changing anything")
+	flag.Parse()
+
+	policy, err := config.GetChatRetentionConfig()
+	if err != nil {
+		log.Fatal("Invalid chat retention policy:", err)
+	}
+
+	config.ConnectDatabase()
+	defer config.CloseDatabase()
+	config.DB.Logger = config.DB.Logger.LogMode(logger.Warn)
+
+	blobStore, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure blob store:", err)
+	}
+
+	retention := handlers.NewChatRetention(*policy, blobStore)
+	ctx := context.Background()
+
+	if *dryRun {
+		report, err := retention.Report(ctx)
+		if err != nil {
+			log.Fatal("Failed to build retention report:", err)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	purged, err := retention.Purge(ctx)
+	if err != nil {
+		log.Fatalf("Chat retention stopped after %d messages: %v", purged, err)
+	}
+	log.Printf("Archived and purged %d expired chat messages", purged)
+}
@@ -0,0 +1,23 @@
+// Command rebuild-ratings recounts every product's rating totals from its
+// published reviews, for when they are suspected to have drifted.
+package main
+
+import (
+	"log"
+
+	"shopsphere-backend/config"
+
+	"gorm.io/gorm/logger"
+)
+
+func main() {
+	config.ConnectDatabase()
+	defer config.CloseDatabase()
+	config.DB.Logger = config.DB.Logger.LogMode(logger.Warn)
+
+	products, err := config.RebuildProductRatings(config.GetDB())
+	if err != nil {
+		log.Fatal("Failed to rebuild product ratings:", err)
+	}
+	log.Printf("Rebuilt rating totals of %d products", products)
+}
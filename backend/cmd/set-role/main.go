@@ -0,0 +1,58 @@
+// Command set-role gives existing users a role, which is how moderators are
+// made: registration only offers seller and customer.
+//
+//	go run ./cmd/set-role -role moderator alice bob
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/models"
+
+	"gorm.io/gorm/logger"
+)
+
+var roles = map[string]bool{"seller": true, "customer": true, "moderator": true}
+
+func main() {
+	role := flag.String("role", "moderator", "role to give the users: seller, customer or moderator")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: set-role [-role moderator] username...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if !roles[*role] {
+		log.Fatalf("Unknown role %q", *role)
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config.ConnectDatabase()
+	defer config.CloseDatabase()
+	config.DB.Logger = config.DB.Logger.LogMode(logger.Warn)
+
+	failed := false
+	for _, username := range flag.Args() {
+		result := config.GetDB().Model(&models.User{}).Where("username = ?", username).Update("role", *role)
+		switch {
+		case result.Error != nil:
+			log.Printf("Failed to update %s: %v", username, result.Error)
+			failed = true
+		case result.RowsAffected == 0:
+			log.Printf("No user named %s", username)
+			failed = true
+		default:
+			log.Printf("%s is now a %s", username, *role)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
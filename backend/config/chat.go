@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ChatRetentionConfig is how long messages are kept in each type of room
+// before they are archived and purged. Zero keeps them forever.
+type ChatRetentionConfig struct {
+	Direct time.Duration
+	Group  time.Duration
+}
+
+func GetChatRetentionConfig() (*ChatRetentionConfig, error) {
+	direct, err := retentionDays("CHAT_RETENTION_DIRECT_DAYS")
+	if err != nil {
+		return nil, err
+	}
+	group, err := retentionDays("CHAT_RETENTION_GROUP_DAYS")
+	if err != nil {
+		return nil, err
+	}
+	return &ChatRetentionConfig{Direct: direct, Group: group}, nil
+}
+
+// ForRoomType returns the retention period of a room type.
+func (c *ChatRetentionConfig) ForRoomType(roomType string) time.Duration {
+	if roomType == "direct" {
+		return c.Direct
+	}
+	return c.Group
+}
+
+func retentionDays(key string) (time.Duration, error) {
+	days, err := strconv.Atoi(getEnv(key, "0"))
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("%s must be a whole number of days", key)
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// chatDirectKeyBackfill gives the oldest direct room of each participant pair
+// created before rooms were deduplicated a direct_key, so contacting the
+// same person again reopens it instead of adding yet another copy.
+const chatDirectKeyBackfill = `
+WITH pairs AS (
+	SELECT r.id, r.created_at, MIN(cru.user_id::text) AS first_user, MAX(cru.user_id::text) AS second_user
+	FROM chat_rooms r
+	JOIN chat_room_users cru ON cru.room_id = r.id
+	WHERE r.type = 'direct' AND r.direct_key IS NULL AND r.product_id IS NULL
+	GROUP BY r.id, r.created_at
+	HAVING COUNT(DISTINCT cru.user_id) = 2
+), ranked AS (
+	SELECT id, first_user || ':' || second_user || ':' AS direct_key,
+		ROW_NUMBER() OVER (PARTITION BY first_user, second_user ORDER BY created_at, id) AS position
+	FROM pairs
+)
+UPDATE chat_rooms SET direct_key = ranked.direct_key
+FROM ranked
+WHERE chat_rooms.id = ranked.id
+	AND ranked.position = 1
+	AND NOT EXISTS (SELECT 1 FROM chat_rooms existing WHERE existing.direct_key = ranked.direct_key)`
+
+// chatSetupStatements run after AutoMigrate, which neither alters existing
+// check constraints nor knows who should own rooms created before roles.
+var chatSetupStatements = []string{
+	`DO $$
+	BEGIN
+		IF NOT EXISTS (
+			SELECT 1 FROM pg_constraint
+			WHERE conname = 'chk_chat_messages_message_type'
+				AND pg_get_constraintdef(oid) LIKE '%system%'
+		) THEN
+			ALTER TABLE chat_messages DROP CONSTRAINT IF EXISTS chk_chat_messages_message_type;
+			ALTER TABLE chat_messages ADD CONSTRAINT chk_chat_messages_message_type
+				CHECK (message_type IN ('text', 'image', 'file', 'system'));
+		END IF;
+	END $$`,
+	`UPDATE chat_room_users SET role = 'owner'
+	FROM chat_rooms
+	WHERE chat_rooms.id = chat_room_users.room_id
+		AND chat_rooms.type = 'group'
+		AND chat_room_users.user_id = chat_rooms.created_by
+		AND NOT EXISTS (
+			SELECT 1 FROM chat_room_users owners
+			WHERE owners.room_id = chat_rooms.id AND owners.role = 'owner'
+		)`,
+	chatDirectKeyBackfill,
+}
+
+func setupChat(db *gorm.DB) error {
+	for _, statement := range chatSetupStatements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
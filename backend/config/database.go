@@ -41,14 +41,16 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func (c *DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=UTC",
+		c.Host, c.User, c.Password, c.DBName, c.Port, c.SSLMode)
+}
+
 func ConnectDatabase() {
 	config := GetDatabaseConfig()
 
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=UTC",
-		config.Host, config.User, config.Password, config.DBName, config.Port, config.SSLMode)
-
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+	DB, err = gorm.Open(postgres.Open(config.DSN()), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
 
@@ -67,14 +69,70 @@ func ConnectDatabase() {
 }
 
 func AutoMigrate() error {
-	return DB.AutoMigrate(
+	// Products from before stock was tracked get a starting count once the
+	// column exists.
+	backfillStock := DB.Migrator().HasTable(&models.Product{}) && !DB.Migrator().HasColumn(&models.Product{}, "stock")
+
+	if err := dropDuplicateReviews(DB); err != nil {
+		return err
+	}
+
+	err := DB.AutoMigrate(
 		&models.User{},
 		&models.Product{},
+		&models.ProductVariant{},
+		&models.ProductRating{},
 		&models.Review{},
+		&models.ReviewVote{},
+		&models.ReviewReply{},
+		&models.ReviewPhoto{},
+		&models.ReviewReport{},
+		&models.ReviewModerationEvent{},
 		&models.ChatRoom{},
 		&models.ChatRoomUser{},
+		&models.ChatAttachment{},
 		&models.ChatMessage{},
+		&models.ChatMessageRevision{},
+		&models.ChatMessageReaction{},
+		&models.ChatPresence{},
+		&models.ChatEventRecord{},
+		&models.Cart{},
+		&models.CartItem{},
+		&models.Order{},
+		&models.OrderItem{},
+		&models.OrderStatusHistory{},
+		&models.Purchase{},
+		&models.Payment{},
+		&models.PaymentWebhookEvent{},
+		&models.InventoryReservation{},
 	)
+	if err != nil {
+		return err
+	}
+
+	if backfillStock {
+		if err := backfillProductStock(DB); err != nil {
+			return err
+		}
+	}
+
+	// Cart lines used to be unique per product; they are now unique per
+	// product variant, so the old index has to go.
+	if DB.Migrator().HasIndex(&models.CartItem{}, "idx_cart_items_cart_product") {
+		if err := DB.Migrator().DropIndex(&models.CartItem{}, "idx_cart_items_cart_product"); err != nil {
+			return err
+		}
+	}
+
+	if err := setupChat(DB); err != nil {
+		return err
+	}
+
+	if err := setupReviews(DB); err != nil {
+		return err
+	}
+
+	return setupSearch(DB)
 }
 
 func GetDB() *gorm.DB {
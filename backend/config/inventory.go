@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"shopsphere-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// backfillProductStock gives the products that existed before stock was
+// tracked INITIAL_PRODUCT_STOCK units each. Without it they would all start
+// at 0 and be impossible to buy until their sellers set a count. It runs only
+// on the migration that adds the stock column.
+func backfillProductStock(db *gorm.DB) error {
+	stock, err := strconv.Atoi(getEnv("INITIAL_PRODUCT_STOCK", "100"))
+	if err != nil || stock < 0 {
+		return fmt.Errorf("INITIAL_PRODUCT_STOCK must be a whole number of at least 0")
+	}
+
+	result := db.Model(&models.Product{}).Where("stock = 0").Update("stock", stock)
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Set stock of %d existing products to %d", result.RowsAffected, stock)
+	return nil
+}
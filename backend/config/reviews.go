@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"shopsphere-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ReviewModerationConfig tunes automatic review holds.
+type ReviewModerationConfig struct {
+	// ReportThreshold is how many open reports send a published review back
+	// to moderation.
+	ReportThreshold int
+	// HoldPhotos sends a review back to moderation when a photo is added.
+	HoldPhotos bool
+}
+
+func GetReviewModerationConfig() (*ReviewModerationConfig, error) {
+	threshold, err := strconv.Atoi(getEnv("REVIEW_REPORT_THRESHOLD", "3"))
+	if err != nil || threshold < 1 {
+		return nil, fmt.Errorf("REVIEW_REPORT_THRESHOLD must be a positive whole number")
+	}
+	holdPhotos, err := strconv.ParseBool(getEnv("REVIEW_HOLD_PHOTOS", "true"))
+	if err != nil {
+		return nil, fmt.Errorf("REVIEW_HOLD_PHOTOS must be true or false")
+	}
+	return &ReviewModerationConfig{ReportThreshold: threshold, HoldPhotos: holdPhotos}, nil
+}
+
+// productRatingsInsert recomputes the rating totals of every product from its
+// published reviews.
+const productRatingsInsert = `
+INSERT INTO product_ratings (product_id, rating_count, rating_sum, stars_1, stars_2, stars_3, stars_4, stars_5, updated_at)
+SELECT p.id, COUNT(*), SUM(r.rating),
+	COUNT(*) FILTER (WHERE r.rating = 1),
+	COUNT(*) FILTER (WHERE r.rating = 2),
+	COUNT(*) FILTER (WHERE r.rating = 3),
+	COUNT(*) FILTER (WHERE r.rating = 4),
+	COUNT(*) FILTER (WHERE r.rating = 5),
+	NOW()
+FROM reviews r
+JOIN products p ON p.id::text = r.product_id::text
+WHERE r.status = 'published'
+GROUP BY p.id`
+
+// RebuildProductRatings throws away the product rating totals and recounts
+// them from the reviews. The table lock makes review writes wait until the
+// rebuild commits, so none is counted twice or lost. It returns how many
+// products have ratings.
+func RebuildProductRatings(db *gorm.DB) (int64, error) {
+	var products int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("LOCK TABLE product_ratings IN EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM product_ratings").Error; err != nil {
+			return err
+		}
+		result := tx.Exec(productRatingsInsert)
+		products = result.RowsAffected
+		return result.Error
+	})
+	return products, err
+}
+
+// reviewSetupStatements let users be moderators, which AutoMigrate cannot
+// add to the existing role check, record purchases for orders shipped before
+// purchases were tracked, then flag the reviews those purchases verify.
+var reviewSetupStatements = []string{
+	`DO $$
+	BEGIN
+		IF NOT EXISTS (
+			SELECT 1 FROM pg_constraint
+			WHERE conname = 'chk_users_role'
+				AND pg_get_constraintdef(oid) LIKE '%moderator%'
+		) THEN
+			ALTER TABLE users DROP CONSTRAINT IF EXISTS chk_users_role;
+			ALTER TABLE users ADD CONSTRAINT chk_users_role
+				CHECK (role IN ('seller', 'customer', 'moderator'));
+		END IF;
+	END $$`,
+	`INSERT INTO purchases (id, buyer_id, product_id, order_id, order_item_id, confirmed_at)
+	SELECT gen_random_uuid(), o.buyer_id, oi.product_id, o.id, oi.id, o.updated_at
+	FROM order_items oi
+	JOIN orders o ON o.id = oi.order_id
+	WHERE o.status IN ('shipped', 'delivered')
+	ON CONFLICT (order_item_id) DO NOTHING`,
+	`UPDATE reviews SET verified_purchase = true
+	WHERE NOT verified_purchase
+		AND EXISTS (
+			SELECT 1 FROM purchases p
+			WHERE p.buyer_id = reviews.user_id AND p.product_id = reviews.product_id
+		)`,
+}
+
+// dropDuplicateReviews keeps only the first review of each product by each
+// user, which idx_reviews_product_user cannot be created without. Duplicates
+// could only come from concurrent requests before the index existed.
+func dropDuplicateReviews(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.Review{}) || db.Migrator().HasIndex(&models.Review{}, "idx_reviews_product_user") {
+		return nil
+	}
+	return db.Exec(`DELETE FROM reviews r
+	USING reviews k
+	WHERE r.product_id = k.product_id AND r.user_id = k.user_id
+		AND (r.created_at, r.id) > (k.created_at, k.id)`).Error
+}
+
+func setupReviews(db *gorm.DB) error {
+	for _, statement := range reviewSetupStatements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	// Rating totals start out empty; count the reviews written before they
+	// were kept.
+	var rated int64
+	if err := db.Raw("SELECT COUNT(*) FROM product_ratings").Scan(&rated).Error; err != nil {
+		return err
+	}
+	if rated == 0 {
+		_, err := RebuildProductRatings(db)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import "gorm.io/gorm"
+
+// SearchConfig is the Postgres text search configuration used for catalogue
+// and chat search. Postgres ships no Polish stemmer, so it is the "simple"
+// parser (lowercasing, no stemming or stop words) with unaccent applied
+// first, which lets "ksiazka" find "Książka" and vice versa.
+const SearchConfig = "shopsphere"
+
+var searchSetupStatements = []string{
+	`CREATE EXTENSION IF NOT EXISTS unaccent`,
+	`DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = '` + SearchConfig + `') THEN
+			CREATE TEXT SEARCH CONFIGURATION ` + SearchConfig + ` (COPY = simple);
+			ALTER TEXT SEARCH CONFIGURATION ` + SearchConfig + `
+				ALTER MAPPING FOR hword, hword_part, word WITH unaccent, simple;
+		END IF;
+	END $$`,
+	`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (
+			setweight(to_tsvector('` + SearchConfig + `', coalesce(name, '')), 'A') ||
+			setweight(to_tsvector('` + SearchConfig + `', coalesce(category, '')), 'B') ||
+			setweight(to_tsvector('` + SearchConfig + `', coalesce(description, '')), 'C')
+		) STORED`,
+	`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)`,
+	`ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (to_tsvector('` + SearchConfig + `', coalesce(message, ''))) STORED`,
+	`CREATE INDEX IF NOT EXISTS idx_chat_messages_search_vector ON chat_messages USING GIN (search_vector)`,
+}
+
+func setupSearch(db *gorm.DB) error {
+	for _, statement := range searchSetupStatements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
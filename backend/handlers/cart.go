@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CartHandler struct{}
+
+func NewCartHandler() *CartHandler {
+	return &CartHandler{}
+}
+
+func (h *CartHandler) GetCart(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	cart, err := findOrCreateCart(config.GetDB(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+		return
+	}
+
+	response, err := buildCartResponse(config.GetDB(), cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *CartHandler) AddItem(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var req models.CartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var product models.Product
+	if err := config.GetDB().Where("id = ?", req.ProductID).First(&product).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	variant, err := resolveVariant(config.GetDB(), &product, req.VariantID)
+	if err != nil {
+		respondWithError(c, err, "Failed to add item to cart")
+		return
+	}
+
+	cart, err := findOrCreateCart(config.GetDB(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+		return
+	}
+
+	var item models.CartItem
+	err = config.GetDB().Where("cart_id = ? AND product_id = ? AND variant_id = ?", cart.ID, product.ID, req.VariantID).First(&item).Error
+	switch {
+	case err == nil:
+		item.Quantity += req.Quantity
+		if item.Quantity > maxCartItemQuantity {
+			item.Quantity = maxCartItemQuantity
+		}
+		item.UnitPrice = unitPrice(&product, variant)
+		err = config.GetDB().Save(&item).Error
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		item = models.CartItem{
+			CartID:    cart.ID,
+			ProductID: product.ID,
+			VariantID: req.VariantID,
+			Quantity:  req.Quantity,
+			UnitPrice: unitPrice(&product, variant),
+		}
+		err = config.GetDB().Create(&item).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add item to cart"})
+		return
+	}
+
+	h.respondWithCart(c, cart)
+}
+
+func (h *CartHandler) UpdateItem(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var req models.UpdateCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, item, ok := h.findCartItem(c, userID, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var product models.Product
+	if err := config.GetDB().Where("id = ?", item.ProductID).First(&product).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product is no longer available"})
+		return
+	}
+
+	variant, err := resolveVariant(config.GetDB(), &product, item.VariantID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product is no longer available"})
+		return
+	}
+
+	item.Quantity = req.Quantity
+	item.UnitPrice = unitPrice(&product, variant)
+	if err := config.GetDB().Save(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart item"})
+		return
+	}
+
+	h.respondWithCart(c, cart)
+}
+
+func (h *CartHandler) RemoveItem(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	cart, item, ok := h.findCartItem(c, userID, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if err := config.GetDB().Delete(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove cart item"})
+		return
+	}
+
+	h.respondWithCart(c, cart)
+}
+
+func (h *CartHandler) ClearCart(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	cart, err := findOrCreateCart(config.GetDB(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+		return
+	}
+
+	if err := config.GetDB().Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
+		return
+	}
+
+	h.respondWithCart(c, cart)
+}
+
+func (h *CartHandler) findCartItem(c *gin.Context, userID, itemID string) (*models.Cart, models.CartItem, bool) {
+	var item models.CartItem
+
+	cart, err := findOrCreateCart(config.GetDB(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+		return nil, item, false
+	}
+
+	if err := config.GetDB().Where("id = ? AND cart_id = ?", itemID, cart.ID).First(&item).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
+		return nil, item, false
+	}
+
+	return cart, item, true
+}
+
+func (h *CartHandler) respondWithCart(c *gin.Context, cart *models.Cart) {
+	response, err := buildCartResponse(config.GetDB(), cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+const maxCartItemQuantity = 99
+
+func findOrCreateCart(db *gorm.DB, userID string) (*models.Cart, error) {
+	cart := models.Cart{UserID: userID}
+	if err := db.Where("user_id = ?", userID).FirstOrCreate(&cart).Error; err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// buildCartResponse prices every line against the current product row rather
+// than the price stored when the item was added, flagging lines whose price
+// has moved or whose product has been deleted since.
+func buildCartResponse(db *gorm.DB, cart *models.Cart) (*models.CartResponse, error) {
+	var items []models.CartItem
+	if err := db.Where("cart_id = ?", cart.ID).Order("created_at ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	productIDs := make([]string, 0, len(items))
+	var variantIDs []string
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+		if item.VariantID != "" {
+			variantIDs = append(variantIDs, item.VariantID)
+		}
+	}
+
+	products := make(map[string]models.Product)
+	if len(productIDs) > 0 {
+		var found []models.Product
+		if err := db.Where("id IN ?", productIDs).Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, product := range found {
+			products[product.ID] = product
+		}
+	}
+
+	variants := make(map[string]models.ProductVariant)
+	if len(variantIDs) > 0 {
+		var found []models.ProductVariant
+		if err := db.Where("id IN ?", variantIDs).Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, variant := range found {
+			variants[variant.ID] = variant
+		}
+	}
+
+	response := &models.CartResponse{
+		ID:    cart.ID,
+		Items: make([]models.CartLine, 0, len(items)),
+	}
+
+	for _, item := range items {
+		line := models.CartLine{
+			ID:         item.ID,
+			ProductID:  item.ProductID,
+			VariantID:  item.VariantID,
+			Quantity:   item.Quantity,
+			Price:      item.UnitPrice,
+			AddedPrice: item.UnitPrice,
+		}
+
+		product, exists := products[item.ProductID]
+		var variant *models.ProductVariant
+		if exists && item.VariantID != "" {
+			found, variantExists := variants[item.VariantID]
+			exists = variantExists
+			variant = &found
+		}
+		if !exists {
+			response.HasUnavailable = true
+			response.Items = append(response.Items, line)
+			continue
+		}
+
+		if variant != nil {
+			line.VariantName = variant.Name
+			line.SKU = variant.SKU
+		}
+		price := unitPrice(&product, variant)
+
+		line.Name = product.Name
+		line.ImageURL = product.ImageURL
+		line.SellerID = product.SellerID
+		line.SellerName = product.SellerName
+		line.Category = product.Category
+		line.Available = true
+		line.Price = price
+		line.PriceChanged = price != item.UnitPrice
+		line.LineTotal = roundPrice(price * float64(item.Quantity))
+
+		if line.PriceChanged {
+			response.HasPriceChanges = true
+		}
+		response.ItemCount += item.Quantity
+		response.Subtotal += line.LineTotal
+		response.Items = append(response.Items, line)
+	}
+
+	response.Subtotal = roundPrice(response.Subtotal)
+
+	return response, nil
+}
+
+func roundPrice(value float64) float64 {
+	return math.Round(value*100) / 100
+}
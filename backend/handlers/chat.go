@@ -1,35 +1,51 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
-	"sync"
+	"time"
 
+	"shopsphere-backend/broadcast"
 	"shopsphere-backend/config"
 	"shopsphere-backend/middleware"
 	"shopsphere-backend/models"
+	"shopsphere-backend/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
 )
 
 type ChatHandler struct {
-	upgrader websocket.Upgrader
-	clients  map[string]*websocket.Conn
-	mutex    sync.RWMutex
+	upgrader    websocket.Upgrader
+	hub         *chatHub
+	presence    *chatPresence
+	broadcaster broadcast.Broadcaster
+	blobs       storage.BlobStore
 }
 
-func NewChatHandler() *ChatHandler {
-	return &ChatHandler{
+// NewChatHandler delivers everything published on broadcaster to this
+// instance's sockets, so messages reach users connected to other replicas.
+func NewChatHandler(broadcaster broadcast.Broadcaster, blobs storage.BlobStore) *ChatHandler {
+	h := &ChatHandler{
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 
 				return true
 			},
 		},
-		clients: make(map[string]*websocket.Conn),
+		hub:         newChatHub(),
+		presence:    newChatPresence(),
+		broadcaster: broadcaster,
+		blobs:       blobs,
 	}
+	broadcaster.Subscribe(h.receive)
+	return h
 }
 
 func (h *ChatHandler) GetChatRooms(c *gin.Context) {
@@ -49,7 +65,179 @@ func (h *ChatHandler) GetChatRooms(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"chat_rooms": chatRooms})
+	summaries, err := summarizeChatRooms(config.GetDB(), userID, chatRooms)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch chat rooms"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"chat_rooms": summaries})
+}
+
+// chatUnreadCountsSQL counts other participants' messages after each of the
+// user's read markers. If the marked message is gone it falls back to
+// last_read_at.
+const chatUnreadCountsSQL = `
+SELECT cru.room_id, COUNT(m.id) AS unread_count
+FROM chat_room_users cru
+LEFT JOIN chat_messages lr ON lr.id = cru.last_read_message_id
+JOIN chat_messages m ON m.room_id = cru.room_id AND m.user_id <> cru.user_id AND m.deleted_at IS NULL
+WHERE cru.user_id = ?
+	AND (
+		(lr.id IS NOT NULL AND (m.created_at, m.id) > (lr.created_at, lr.id))
+		OR (lr.id IS NULL AND (cru.last_read_at IS NULL OR m.created_at > cru.last_read_at))
+	)
+GROUP BY cru.room_id`
+
+func summarizeChatRooms(db *gorm.DB, userID string, chatRooms []models.ChatRoom) ([]models.ChatRoomSummary, error) {
+	summaries := make([]models.ChatRoomSummary, 0, len(chatRooms))
+	if len(chatRooms) == 0 {
+		return summaries, nil
+	}
+
+	roomIDs := make([]string, 0, len(chatRooms))
+	for _, room := range chatRooms {
+		roomIDs = append(roomIDs, room.ID)
+	}
+
+	var memberships []models.ChatRoomUser
+	if err := db.Where("user_id = ? AND room_id IN ?", userID, roomIDs).Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	lastRead := make(map[string]*string, len(memberships))
+	for _, membership := range memberships {
+		lastRead[membership.RoomID] = membership.LastReadMessageID
+	}
+
+	var counts []struct {
+		RoomID      string
+		UnreadCount int64
+	}
+	if err := db.Raw(chatUnreadCountsSQL, userID).Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	unread := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		unread[count.RoomID] = count.UnreadCount
+	}
+
+	var lastMessages []models.ChatMessage
+	if err := db.Raw("SELECT DISTINCT ON (room_id) * FROM chat_messages WHERE room_id IN ? AND deleted_at IS NULL ORDER BY room_id, created_at DESC, id DESC", roomIDs).
+		Scan(&lastMessages).Error; err != nil {
+		return nil, err
+	}
+	latest := make(map[string]*models.ChatMessage, len(lastMessages))
+	for i := range lastMessages {
+		latest[lastMessages[i].RoomID] = &lastMessages[i]
+	}
+
+	for _, room := range chatRooms {
+		summaries = append(summaries, models.ChatRoomSummary{
+			ChatRoom:          room,
+			UnreadCount:       unread[room.ID],
+			LastReadMessageID: lastRead[room.ID],
+			LastMessage:       latest[room.ID],
+		})
+	}
+
+	return summaries, nil
+}
+
+// MarkRoomRead moves the caller's read marker to the given message, or to the
+// newest message in the room. The marker never moves backwards, so a stale
+// request from another tab cannot resurrect unread messages.
+func (h *ChatHandler) MarkRoomRead(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	roomID := c.Param("id")
+
+	var req models.MarkChatReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var participant models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).First(&participant).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant in this chat room"})
+		return
+	}
+
+	if err := h.markRead(c.Request.Context(), &participant, req.MessageID); err != nil {
+		respondWithError(c, err, "Failed to mark chat room as read")
+		return
+	}
+
+	c.JSON(http.StatusOK, participant)
+}
+
+func (h *ChatHandler) markRead(ctx context.Context, participant *models.ChatRoomUser, messageID string) error {
+	var message models.ChatMessage
+	query := config.GetDB().Where("room_id = ?", participant.RoomID)
+	if messageID != "" {
+		query = query.Where("id = ?", messageID)
+	}
+	if err := query.Order("created_at DESC, id DESC").First(&message).Error; err != nil {
+		if messageID != "" {
+			return newRequestError(http.StatusNotFound, "Message not found")
+		}
+		return nil
+	}
+
+	readAt := time.Now()
+	result := config.GetDB().Model(&models.ChatRoomUser{}).
+		Where("id = ?", participant.ID).
+		Where("last_read_message_id IS NULL OR NOT EXISTS (SELECT 1 FROM chat_messages lr WHERE lr.id = chat_room_users.last_read_message_id AND (lr.created_at, lr.id) >= (?, ?))", message.CreatedAt, message.ID).
+		Updates(map[string]interface{}{
+			"last_read_message_id": message.ID,
+			"last_read_at":         readAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		participant.LastReadMessageID = &message.ID
+		participant.LastReadAt = &readAt
+
+		h.publish(ctx, participant.RoomID, models.ChatEventReceipt, models.ChatReadReceipt{
+			UserID:    participant.UserID,
+			MessageID: message.ID,
+			ReadAt:    readAt,
+		})
+	}
+
+	return nil
+}
+
+// GetRoomPresence returns whether each participant currently has a chat
+// connection open on any instance, and when they were last seen.
+func (h *ChatHandler) GetRoomPresence(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	roomID := c.Param("id")
+
+	var participant models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).First(&participant).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant in this chat room"})
+		return
+	}
+
+	presence, err := chatRoomPresence(config.GetDB(), roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch presence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"presence": presence})
 }
 
 func (h *ChatHandler) GetChatRoom(c *gin.Context) {
@@ -82,9 +270,16 @@ func (h *ChatHandler) GetChatRoom(c *gin.Context) {
 		return
 	}
 
+	var members []models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ?", roomID).Order("joined_at ASC, id ASC").Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch participants"})
+		return
+	}
+
 	response := gin.H{
 		"chat_room":    chatRoom,
 		"participants": participants,
+		"members":      members,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -103,11 +298,27 @@ func (h *ChatHandler) CreateChatRoom(c *gin.Context) {
 		return
 	}
 
+	if req.ProductID != "" {
+		var product models.Product
+		if err := config.GetDB().Where("id = ?", req.ProductID).First(&product).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+	}
+
+	if req.Type == "direct" {
+		h.createDirectRoom(c, userID, req)
+		return
+	}
+
 	chatRoom := models.ChatRoom{
 		Name:      req.Name,
 		Type:      req.Type,
 		CreatedBy: userID,
 	}
+	if req.ProductID != "" {
+		chatRoom.ProductID = &req.ProductID
+	}
 
 	if err := config.GetDB().Create(&chatRoom).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create chat room"})
@@ -117,6 +328,7 @@ func (h *ChatHandler) CreateChatRoom(c *gin.Context) {
 	participant := models.ChatRoomUser{
 		RoomID: chatRoom.ID,
 		UserID: userID,
+		Role:   models.ChatRoleOwner,
 	}
 	if err := config.GetDB().Create(&participant).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add creator as participant"})
@@ -142,6 +354,44 @@ func (h *ChatHandler) CreateChatRoom(c *gin.Context) {
 	c.JSON(http.StatusCreated, chatRoom)
 }
 
+// createDirectRoom returns the existing direct room with the other user (for
+// the same product, if any) with 200, or creates it with 201.
+func (h *ChatHandler) createDirectRoom(c *gin.Context, userID string, req models.CreateChatRoomRequest) {
+	var otherUserID string
+	for _, participantID := range req.Participants {
+		if participantID == userID || participantID == otherUserID {
+			continue
+		}
+		if otherUserID != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Direct chat rooms have exactly two participants"})
+			return
+		}
+		otherUserID = participantID
+	}
+	if otherUserID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Direct chat rooms need another participant"})
+		return
+	}
+
+	var otherUser models.User
+	if err := config.GetDB().Where("id = ?", otherUserID).First(&otherUser).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	room, created, err := findOrCreateDirectRoom(config.GetDB(), userID, otherUserID, req.ProductID, req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create chat room"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, room)
+}
+
 func (h *ChatHandler) GetChatMessages(c *gin.Context) {
 	userID, _, _, ok := middleware.GetUserFromContext(c)
 	if !ok {
@@ -157,6 +407,17 @@ func (h *ChatHandler) GetChatMessages(c *gin.Context) {
 		return
 	}
 
+	cursor, cursorMode, err := cursorRequest(c, chatMessageOrder)
+	if err != nil {
+		respondWithError(c, err, "Failed to fetch messages")
+		return
+	}
+
+	if cursorMode {
+		h.getChatMessagesByCursor(c, roomID, userID, cursor)
+		return
+	}
+
 	page := 1
 	limit := 50
 	if p := c.Query("page"); p != "" {
@@ -174,8 +435,9 @@ func (h *ChatHandler) GetChatMessages(c *gin.Context) {
 
 	var messages []models.ChatMessage
 	if err := config.GetDB().
+		Preload("Attachment").
 		Where("room_id = ?", roomID).
-		Order("created_at DESC").
+		Order(chatMessageOrder.clause(false)).
 		Offset(offset).
 		Limit(limit).
 		Find(&messages).Error; err != nil {
@@ -183,13 +445,50 @@ func (h *ChatHandler) GetChatMessages(c *gin.Context) {
 		return
 	}
 
+	if err := loadChatReactionsForList(config.GetDB(), messages); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+		return
+	}
+
 	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
 		messages[i], messages[j] = messages[j], messages[i]
 	}
+	signMessageAttachments(messages, userID)
 
 	c.JSON(http.StatusOK, gin.H{"messages": messages})
 }
 
+// chatMessageOrder pages from the newest message backwards, so next_cursor
+// loads older history; each page is still returned oldest first.
+var chatMessageOrder = keysetOrder{name: "newest", keyExpr: "created_at", idColumn: "id", desc: true}
+
+func (h *ChatHandler) getChatMessagesByCursor(c *gin.Context, roomID, userID string, cursor *pageCursor) {
+	limit := cursorLimit(c, 50)
+
+	var messages []models.ChatMessage
+	query := config.GetDB().Preload("Attachment").Where("room_id = ?", roomID)
+	if err := chatMessageOrder.apply(query, cursor).Limit(limit + 1).Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+		return
+	}
+
+	messages, pagination := keysetPage(messages, limit, cursor, chatMessageOrder, func(message models.ChatMessage) (interface{}, string) {
+		return message.CreatedAt, message.ID
+	})
+
+	if err := loadChatReactionsForList(config.GetDB(), messages); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+		return
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	signMessageAttachments(messages, userID)
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages, "pagination": pagination})
+}
+
 func (h *ChatHandler) SendMessage(c *gin.Context) {
 	userID, username, _, ok := middleware.GetUserFromContext(c)
 	if !ok {
@@ -208,31 +507,65 @@ func (h *ChatHandler) SendMessage(c *gin.Context) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant in this chat room"})
 		return
 	}
+	if chatMuted(&participant) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are muted in this chat room"})
+		return
+	}
+
+	if req.MessageType != "" && req.MessageType != "text" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Images and files must be sent through the attachments endpoint"})
+		return
+	}
 
+	message, err := h.createMessage(c.Request.Context(), req.RoomID, userID, username, req, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, message)
+}
+
+// createMessage saves a message, together with its attachment row when it
+// has one, and publishes it to the room.
+func (h *ChatHandler) createMessage(ctx context.Context, roomID, userID, username string, req models.ChatMessageRequest, attachment *models.ChatAttachment) (*models.ChatMessage, error) {
 	if req.MessageType == "" {
 		req.MessageType = "text"
 	}
 
 	message := models.ChatMessage{
-		RoomID:      req.RoomID,
+		RoomID:      roomID,
 		UserID:      userID,
 		UserName:    username,
 		Message:     req.Message,
 		MessageType: req.MessageType,
 	}
 
-	if err := config.GetDB().Create(&message).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
-		return
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if attachment != nil {
+			if err := tx.Create(attachment).Error; err != nil {
+				return err
+			}
+			message.AttachmentID = &attachment.ID
+		}
+		return tx.Omit("Attachment").Create(&message).Error
+	})
+	if err != nil {
+		return nil, err
 	}
+	message.Attachment = attachment
 
-	config.GetDB().Model(&models.ChatRoom{}).Where("id = ?", req.RoomID).Update("updated_at", message.CreatedAt)
+	config.GetDB().Model(&models.ChatRoom{}).Where("id = ?", roomID).Update("updated_at", message.CreatedAt)
 
-	h.broadcastMessage(req.RoomID, message)
+	h.publish(ctx, roomID, models.ChatEventMessage, message)
 
-	c.JSON(http.StatusCreated, message)
+	return &message, nil
 }
 
+// chatTypingInterval throttles repeated "typing" frames from one connection;
+// clients should treat an indicator as stale after a few seconds without one.
+const chatTypingInterval = 2 * time.Second
+
 func (h *ChatHandler) HandleWebSocket(c *gin.Context) {
 
 	token := c.Query("token")
@@ -262,131 +595,155 @@ func (h *ChatHandler) HandleWebSocket(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	clientKey := roomID + ":" + claims.UserID
-	h.mutex.Lock()
-	h.clients[clientKey] = conn
-	h.mutex.Unlock()
+	client := newChatClient(conn, roomID, claims.UserID, chatSendBufferSize)
+	h.hub.register(client)
+	defer h.hub.unregister(client)
+
+	go client.writePump()
 
-	defer func() {
-		h.mutex.Lock()
-		delete(h.clients, clientKey)
-		h.mutex.Unlock()
-	}()
+	ctx := context.Background()
+	h.connectPresence(ctx, claims.UserID, claims.Username)
+	defer h.disconnectPresence(ctx, claims.UserID, claims.Username)
 
+	conn.SetReadLimit(chatMaxFrameSize)
+	conn.SetReadDeadline(time.Now().Add(chatPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(chatPongWait))
+	})
+
+	var lastTyping time.Time
 	for {
-		var msg models.ChatMessageRequest
-		err := conn.ReadJSON(&msg)
+		var event models.ChatClientEvent
+		err := conn.ReadJSON(&event)
 		if err != nil {
-			log.Printf("WebSocket read error: %v", err)
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("WebSocket read error: %v", err)
+			}
 			break
 		}
 
-		if msg.RoomID != roomID || msg.Message == "" {
-			continue
-		}
-
-		if msg.MessageType == "" {
-			msg.MessageType = "text"
-		}
+		switch event.Type {
+		case models.ChatEventMessage:
+			var req models.ChatMessageRequest
+			if err := json.Unmarshal(event.Data, &req); err != nil || req.Message == "" {
+				h.sendEvent(client, models.ChatEventError, models.ChatError{Error: "Invalid message"})
+				continue
+			}
+			if req.MessageType != "" && req.MessageType != "text" {
+				h.sendEvent(client, models.ChatEventError, models.ChatError{Error: "Images and files must be sent through the attachments endpoint"})
+				continue
+			}
+			// Membership and mutes can change while the socket is open.
+			var current models.ChatRoomUser
+			if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, claims.UserID).First(&current).Error; err != nil {
+				h.sendEvent(client, models.ChatEventError, models.ChatError{Error: "You are not a participant in this chat room"})
+				continue
+			}
+			if chatMuted(&current) {
+				h.sendEvent(client, models.ChatEventError, models.ChatError{Error: "You are muted in this chat room"})
+				continue
+			}
+			if _, err := h.createMessage(ctx, roomID, claims.UserID, claims.Username, req, nil); err != nil {
+				log.Printf("Failed to save message: %v", err)
+				h.sendEvent(client, models.ChatEventError, models.ChatError{Error: "Failed to send message"})
+			}
 
-		message := models.ChatMessage{
-			RoomID:      msg.RoomID,
-			UserID:      claims.UserID,
-			UserName:    claims.Username,
-			Message:     msg.Message,
-			MessageType: msg.MessageType,
-		}
+		case models.ChatEventTyping:
+			var typing models.ChatTyping
+			if err := json.Unmarshal(event.Data, &typing); err != nil {
+				h.sendEvent(client, models.ChatEventError, models.ChatError{Error: "Invalid typing event"})
+				continue
+			}
+			if typing.Typing && time.Since(lastTyping) < chatTypingInterval {
+				continue
+			}
+			if typing.Typing {
+				lastTyping = time.Now()
+			} else {
+				lastTyping = time.Time{}
+			}
+			h.publish(ctx, roomID, models.ChatEventTyping, models.ChatTyping{
+				UserID:   claims.UserID,
+				UserName: claims.Username,
+				Typing:   typing.Typing,
+			})
+
+		case models.ChatEventReceipt:
+			var req models.MarkChatReadRequest
+			if err := json.Unmarshal(event.Data, &req); err != nil {
+				h.sendEvent(client, models.ChatEventError, models.ChatError{Error: "Invalid receipt"})
+				continue
+			}
+			if err := h.markRead(ctx, &participant, req.MessageID); err != nil {
+				h.sendEvent(client, models.ChatEventError, models.ChatError{Error: "Failed to mark chat room as read"})
+			}
 
-		if err := config.GetDB().Create(&message).Error; err != nil {
-			log.Printf("Failed to save message: %v", err)
-			continue
+		default:
+			h.sendEvent(client, models.ChatEventError, models.ChatError{Error: "Unknown event type"})
 		}
-
-		config.GetDB().Model(&models.ChatRoom{}).Where("id = ?", msg.RoomID).Update("updated_at", message.CreatedAt)
-
-		h.broadcastMessage(roomID, message)
 	}
 }
 
-func (h *ChatHandler) broadcastMessage(roomID string, message models.ChatMessage) {
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
-
-	for clientKey, conn := range h.clients {
-
-		if len(clientKey) > len(roomID) && clientKey[:len(roomID)] == roomID {
-			err := conn.WriteJSON(message)
-			if err != nil {
-				log.Printf("WebSocket write error: %v", err)
-				conn.Close()
-				delete(h.clients, clientKey)
-			}
-		}
+func (h *ChatHandler) connectPresence(ctx context.Context, userID, username string) {
+	first, err := h.presence.connect(config.GetDB(), userID)
+	if err != nil {
+		log.Printf("Failed to record chat presence: %v", err)
+	}
+	if first {
+		h.announcePresence(ctx, userID, username, true)
 	}
 }
 
-func (h *ChatHandler) LeaveChatRoom(c *gin.Context) {
-	userID, _, _, ok := middleware.GetUserFromContext(c)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
-		return
+// disconnectPresence only announces the user offline once their last
+// connection on every instance is gone.
+func (h *ChatHandler) disconnectPresence(ctx context.Context, userID, username string) {
+	last, err := h.presence.disconnect(config.GetDB(), userID)
+	if err != nil {
+		log.Printf("Failed to record chat presence: %v", err)
 	}
-
-	roomID := c.Param("id")
-
-	if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).Delete(&models.ChatRoomUser{}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave chat room"})
+	if !last {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Left chat room successfully"})
-}
-
-func (h *ChatHandler) AddParticipant(c *gin.Context) {
-	userID, _, _, ok := middleware.GetUserFromContext(c)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+	online, err := chatUserOnline(config.GetDB(), userID)
+	if err != nil {
+		log.Printf("Failed to check chat presence: %v", err)
 		return
 	}
-
-	roomID := c.Param("id")
-
-	var req struct {
-		UserID string `json:"user_id" binding:"required"`
+	if !online {
+		h.announcePresence(ctx, userID, username, false)
 	}
+}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// sendEvent writes to a single connection without going through the
+// broadcaster, for replies such as errors that only the sender should see.
+func (h *ChatHandler) sendEvent(client *chatClient, eventType string, data interface{}) {
+	frame, err := json.Marshal(models.ChatEvent{Type: eventType, RoomID: client.roomID, Data: data})
+	if err != nil {
+		log.Printf("Failed to encode chat event: %v", err)
 		return
 	}
 
-	var participant models.ChatRoomUser
-	if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).First(&participant).Error; err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant in this chat room"})
-		return
-	}
+	h.hub.sendTo(client, frame)
+}
 
-	var targetUser models.User
-	if err := config.GetDB().Where("id = ?", req.UserID).First(&targetUser).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
+func (h *ChatHandler) publish(ctx context.Context, roomID, eventType string, data interface{}) {
+	event := models.ChatEvent{Type: eventType, RoomID: roomID, Data: data}
+	if !chatEphemeralEvents[eventType] {
+		id, err := recordChatEvent(roomID, eventType, data)
+		if err != nil {
+			log.Printf("Failed to record chat event: %v", err)
+		}
+		event.ID = id
 	}
 
-	var existingParticipant models.ChatRoomUser
-	if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, req.UserID).First(&existingParticipant).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "User is already a participant"})
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode chat event: %v", err)
 		return
 	}
 
-	newParticipant := models.ChatRoomUser{
-		RoomID: roomID,
-		UserID: req.UserID,
+	if err := h.broadcaster.Publish(ctx, roomID, payload); err != nil {
+		log.Printf("Failed to broadcast chat event: %v", err)
 	}
-
-	if err := config.GetDB().Create(&newParticipant).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add participant"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Participant added successfully"})
 }
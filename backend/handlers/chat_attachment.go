@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+	"shopsphere-backend/signedurl"
+	"shopsphere-backend/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const chatAttachmentMaxSize = 10 << 20
+
+// chatAttachmentLinkTTL is kept short because a link keeps working for
+// whoever it is passed on to, as long as the user it was issued to is still
+// in the room.
+const chatAttachmentLinkTTL = 15 * time.Minute
+
+// chatAttachmentTypes maps the sniffed media types we accept to the message
+// type they are posted as. Anything a browser might render as active content
+// (HTML, SVG) is deliberately missing.
+var chatAttachmentTypes = map[string]string{
+	"image/jpeg":      "image",
+	"image/png":       "image",
+	"image/gif":       "image",
+	"image/webp":      "image",
+	"application/pdf": "file",
+	"application/zip": "file",
+	"text/plain":      "file",
+}
+
+// UploadAttachment stores a multipart "file" upload and posts it to the room
+// as an image or file message, with the optional "message" field as caption.
+func (h *ChatHandler) UploadAttachment(c *gin.Context) {
+	userID, username, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	roomID := c.Param("id")
+
+	var participant models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).First(&participant).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant in this chat room"})
+		return
+	}
+	if chatMuted(&participant) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are muted in this chat room"})
+		return
+	}
+
+	// Leave room for the multipart framing around the file itself.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, chatAttachmentMaxSize+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return
+	}
+	if fileHeader.Size > chatAttachmentMaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+		return
+	}
+	if fileHeader.Size == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is empty"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	// The client's Content-Type header is ignored; only the bytes decide.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	contentType := http.DetectContentType(head[:n])
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	messageType, allowed := chatAttachmentTypes[mediaType]
+	if !allowed {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported file type"})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	attachment := models.ChatAttachment{
+		ID:          uuid.New().String(),
+		RoomID:      roomID,
+		UploadedBy:  userID,
+		FileName:    attachmentFileName(fileHeader.Filename),
+		ContentType: contentType,
+		Size:        fileHeader.Size,
+	}
+	attachment.StorageKey = "chat/" + roomID + "/" + attachment.ID
+
+	if err := h.blobs.Put(c.Request.Context(), attachment.StorageKey, file, attachment.Size, contentType); err != nil {
+		log.Printf("Failed to store chat attachment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		return
+	}
+
+	caption := strings.TrimSpace(c.PostForm("message"))
+	if caption == "" {
+		caption = attachment.FileName
+	}
+
+	message, err := h.createMessage(c.Request.Context(), roomID, userID, username, models.ChatMessageRequest{
+		RoomID:      roomID,
+		Message:     caption,
+		MessageType: messageType,
+	}, &attachment)
+	if err != nil {
+		if deleteErr := h.blobs.Delete(c.Request.Context(), attachment.StorageKey); deleteErr != nil {
+			log.Printf("Failed to clean up chat attachment %s: %v", attachment.StorageKey, deleteErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		return
+	}
+	signAttachment(message.Attachment, userID)
+
+	c.JSON(http.StatusCreated, message)
+}
+
+// GetAttachmentLink issues a fresh download link, for attachments that
+// arrived through a room event or whose link has expired.
+func (h *ChatHandler) GetAttachmentLink(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var attachment models.ChatAttachment
+	if err := config.GetDB().Where("id = ?", c.Param("id")).First(&attachment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+
+	var participant models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ? AND user_id = ?", attachment.RoomID, userID).First(&participant).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant in this chat room"})
+		return
+	}
+
+	signAttachment(&attachment, userID)
+	c.JSON(http.StatusOK, attachment)
+}
+
+// DownloadAttachment serves an attachment through a link signed for one user,
+// as long as that user is still in the attachment's room.
+func (h *ChatHandler) DownloadAttachment(c *gin.Context) {
+	userID := c.Query("user")
+	err := signedurl.VerifyFor(c.Request.URL.Path, userID, c.Query("expires"), c.Query("signature"))
+	if errors.Is(err, signedurl.ErrExpired) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Attachment link has expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid attachment link"})
+		return
+	}
+
+	var attachment models.ChatAttachment
+	if err := config.GetDB().Where("id = ?", c.Param("id")).First(&attachment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+
+	var participant models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ? AND user_id = ?", attachment.RoomID, userID).First(&participant).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant in this chat room"})
+		return
+	}
+
+	body, err := h.blobs.Get(c.Request.Context(), attachment.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachment"})
+		return
+	}
+	defer body.Close()
+
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		disposition = "inline"
+	}
+
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, body, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=900",
+	})
+}
+
+// signAttachment fills in the download link of attachment, if any, for userID.
+func signAttachment(attachment *models.ChatAttachment, userID string) {
+	if attachment != nil {
+		attachment.URL = signedurl.SignFor("/api/v1/chat/attachments/"+attachment.ID, userID, chatAttachmentLinkTTL)
+	}
+}
+
+func signMessageAttachments(messages []models.ChatMessage, userID string) {
+	for i := range messages {
+		signAttachment(messages[i].Attachment, userID)
+	}
+}
+
+func attachmentFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	if runes := []rune(name); len(runes) > 255 {
+		name = string(runes[len(runes)-255:])
+	}
+	return name
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func directRoomKey(userID, otherUserID, productID string) string {
+	if otherUserID < userID {
+		userID, otherUserID = otherUserID, userID
+	}
+	return userID + ":" + otherUserID + ":" + productID
+}
+
+// findOrCreateDirectRoom returns the direct room between the two users about
+// productID (empty for a general conversation), creating it if needed. The
+// unique direct_key makes concurrent calls converge on one room, and a user
+// who left the room is added back.
+func findOrCreateDirectRoom(db *gorm.DB, userID, otherUserID, productID, name string) (*models.ChatRoom, bool, error) {
+	key := directRoomKey(userID, otherUserID, productID)
+
+	var room models.ChatRoom
+	created := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		room = models.ChatRoom{
+			Name:      name,
+			Type:      "direct",
+			CreatedBy: userID,
+			DirectKey: &key,
+		}
+		if productID != "" {
+			room.ProductID = &productID
+		}
+
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "direct_key"}},
+			DoNothing: true,
+		}).Create(&room)
+		if result.Error != nil {
+			return result.Error
+		}
+		created = result.RowsAffected > 0
+
+		if !created {
+			room = models.ChatRoom{}
+			if err := tx.Where("direct_key = ?", key).First(&room).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, participantID := range []string{userID, otherUserID} {
+			var participant models.ChatRoomUser
+			err := tx.Where("room_id = ? AND user_id = ?", room.ID, participantID).First(&participant).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = tx.Create(&models.ChatRoomUser{RoomID: room.ID, UserID: participantID}).Error
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &room, created, nil
+}
+
+// ContactSeller opens the buyer's conversation with the seller of a product,
+// reusing the existing one when there is one.
+func (h *ChatHandler) ContactSeller(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var product models.Product
+	if err := config.GetDB().Where("id = ?", c.Param("id")).First(&product).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	if product.SellerID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot contact yourself about your own product"})
+		return
+	}
+
+	room, created, err := findOrCreateDirectRoom(config.GetDB(), userID, product.SellerID, product.ID, product.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open chat room"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, room)
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	chatWriteWait      = 10 * time.Second
+	chatPongWait       = 60 * time.Second
+	chatPingPeriod     = chatPongWait * 9 / 10
+	chatMaxFrameSize   = 16 * 1024
+	chatSendBufferSize = 64
+)
+
+// chatClient is one WebSocket connection. Only its writePump goroutine writes
+// to conn; everything else hands frames over through send.
+type chatClient struct {
+	conn   *websocket.Conn
+	roomID string
+	userID string
+	send   chan []byte
+}
+
+func newChatClient(conn *websocket.Conn, roomID, userID string, bufferSize int) *chatClient {
+	return &chatClient{
+		conn:   conn,
+		roomID: roomID,
+		userID: userID,
+		send:   make(chan []byte, bufferSize),
+	}
+}
+
+func (cl *chatClient) writePump() {
+	ticker := time.NewTicker(chatPingPeriod)
+	defer func() {
+		ticker.Stop()
+		cl.conn.Close()
+	}()
+
+	for {
+		select {
+		case frame, ok := <-cl.send:
+			cl.conn.SetWriteDeadline(time.Now().Add(chatWriteWait))
+			if !ok {
+				cl.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := cl.conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+				return
+			}
+		case <-ticker.C:
+			cl.conn.SetWriteDeadline(time.Now().Add(chatWriteWait))
+			if err := cl.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// chatHub tracks the open connections of every room. A user may hold several
+// connections to the same room (one per tab or device) and each gets its own
+// copy of every frame.
+type chatHub struct {
+	mutex sync.Mutex
+	rooms map[string]map[*chatClient]struct{}
+}
+
+func newChatHub() *chatHub {
+	return &chatHub{rooms: make(map[string]map[*chatClient]struct{})}
+}
+
+func (hub *chatHub) register(client *chatClient) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	clients, exists := hub.rooms[client.roomID]
+	if !exists {
+		clients = make(map[*chatClient]struct{})
+		hub.rooms[client.roomID] = clients
+	}
+	clients[client] = struct{}{}
+}
+
+func (hub *chatHub) unregister(client *chatClient) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.remove(client)
+}
+
+// remove must be called with the mutex held. Closing send tells the client's
+// writePump to send a close frame and shut the connection down.
+func (hub *chatHub) remove(client *chatClient) {
+	clients := hub.rooms[client.roomID]
+	if _, exists := clients[client]; !exists {
+		return
+	}
+	delete(clients, client)
+	close(client.send)
+	if len(clients) == 0 {
+		delete(hub.rooms, client.roomID)
+	}
+}
+
+func (hub *chatHub) sendTo(client *chatClient, frame []byte) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if _, exists := hub.rooms[client.roomID][client]; !exists {
+		return
+	}
+	select {
+	case client.send <- frame:
+	default:
+		hub.remove(client)
+	}
+}
+
+// deliver queues frame for every local connection in the room without
+// blocking. A connection whose queue is full is too slow to keep up and is
+// dropped; the client can reconnect and catch up over the REST history.
+func (hub *chatHub) deliver(roomID string, frame []byte) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	for client := range hub.rooms[roomID] {
+		select {
+		case client.send <- frame:
+		default:
+			log.Printf("Dropping slow chat connection for user %s in room %s", client.userID, roomID)
+			hub.remove(client)
+		}
+	}
+}
+
+// disconnectUser closes every local connection userID holds in the room,
+// used when they stop being a participant.
+func (hub *chatHub) disconnectUser(roomID, userID string) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	for client := range hub.rooms[roomID] {
+		if client.userID == userID {
+			hub.remove(client)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// chatControlPrefix marks broadcaster topics that carry instructions for
+// every instance's hub rather than frames for clients.
+const chatControlPrefix = "control:"
+
+type chatControl struct {
+	Disconnect string `json:"disconnect"`
+}
+
+func chatMuted(participant *models.ChatRoomUser) bool {
+	return participant.MutedUntil != nil && participant.MutedUntil.After(time.Now())
+}
+
+// canModerate reports whether actor may remove, mute or change the role of
+// target: owners manage everyone else, admins only manage members.
+func canModerate(actor, target *models.ChatRoomUser) bool {
+	if actor.UserID == target.UserID {
+		return false
+	}
+	switch actor.Role {
+	case models.ChatRoleOwner:
+		return true
+	case models.ChatRoleAdmin:
+		return target.Role == models.ChatRoleMember
+	default:
+		return false
+	}
+}
+
+func (h *ChatHandler) LeaveChatRoom(c *gin.Context) {
+	userID, username, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	roomID := c.Param("id")
+
+	var participant models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).First(&participant).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant in this chat room"})
+		return
+	}
+
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&participant).Error; err != nil {
+			return err
+		}
+		if participant.Role != models.ChatRoleOwner {
+			return nil
+		}
+
+		// Hand the room to the longest-serving admin, or failing that the
+		// longest-serving member, so a group is never left without an owner.
+		var successor models.ChatRoomUser
+		err := tx.Where("room_id = ?", roomID).
+			Order("CASE WHEN role = 'admin' THEN 0 ELSE 1 END, joined_at ASC, id ASC").
+			First(&successor).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&successor).Update("role", models.ChatRoleOwner).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave chat room"})
+		return
+	}
+
+	h.postSystemMessage(c.Request.Context(), roomID, userID, username, fmt.Sprintf("%s left the room", username))
+	h.disconnectMember(c.Request.Context(), roomID, userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Left chat room successfully"})
+}
+
+func (h *ChatHandler) AddParticipant(c *gin.Context) {
+	userID, username, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	roomID := c.Param("id")
+
+	var req models.AddParticipantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	room, actor, ok := h.findChatMember(c, roomID, userID)
+	if !ok {
+		return
+	}
+	if room.Type == "direct" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Direct chat rooms have exactly two participants"})
+		return
+	}
+	if actor.Role == models.ChatRoleMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only room owners and admins can add participants"})
+		return
+	}
+
+	var targetUser models.User
+	if err := config.GetDB().Where("id = ?", req.UserID).First(&targetUser).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var existingParticipant models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, req.UserID).First(&existingParticipant).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a participant"})
+		return
+	}
+
+	newParticipant := models.ChatRoomUser{
+		RoomID: roomID,
+		UserID: req.UserID,
+		Role:   models.ChatRoleMember,
+	}
+
+	if err := config.GetDB().Create(&newParticipant).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add participant"})
+		return
+	}
+
+	h.postSystemMessage(c.Request.Context(), roomID, userID, username, fmt.Sprintf("%s added %s", username, targetUser.Username))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Participant added successfully"})
+}
+
+func (h *ChatHandler) RemoveParticipant(c *gin.Context) {
+	userID, username, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	roomID := c.Param("id")
+
+	room, actor, ok := h.findChatMember(c, roomID, userID)
+	if !ok {
+		return
+	}
+	if room.Type == "direct" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Participants cannot be removed from direct chat rooms"})
+		return
+	}
+
+	target, targetUser, ok := h.findModeratedMember(c, roomID, actor)
+	if !ok {
+		return
+	}
+
+	if err := config.GetDB().Delete(target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove participant"})
+		return
+	}
+
+	h.postSystemMessage(c.Request.Context(), roomID, userID, username, fmt.Sprintf("%s removed %s", username, targetUser.Username))
+	h.disconnectMember(c.Request.Context(), roomID, target.UserID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Participant removed successfully"})
+}
+
+func (h *ChatHandler) MuteParticipant(c *gin.Context) {
+	userID, username, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	roomID := c.Param("id")
+
+	var req models.MuteParticipantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, actor, ok := h.findChatMember(c, roomID, userID)
+	if !ok {
+		return
+	}
+
+	target, targetUser, ok := h.findModeratedMember(c, roomID, actor)
+	if !ok {
+		return
+	}
+
+	var mutedUntil *time.Time
+	text := fmt.Sprintf("%s unmuted %s", username, targetUser.Username)
+	if req.Minutes > 0 {
+		until := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+		mutedUntil = &until
+		text = fmt.Sprintf("%s muted %s for %d minutes", username, targetUser.Username, req.Minutes)
+	}
+
+	if err := config.GetDB().Model(target).Update("muted_until", mutedUntil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mute participant"})
+		return
+	}
+	target.MutedUntil = mutedUntil
+
+	h.postSystemMessage(c.Request.Context(), roomID, userID, username, text)
+
+	c.JSON(http.StatusOK, target)
+}
+
+func (h *ChatHandler) SetParticipantRole(c *gin.Context) {
+	userID, username, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	roomID := c.Param("id")
+
+	var req models.ChatRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, actor, ok := h.findChatMember(c, roomID, userID)
+	if !ok {
+		return
+	}
+	if actor.Role != models.ChatRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the room owner can change roles"})
+		return
+	}
+
+	target, targetUser, ok := h.findModeratedMember(c, roomID, actor)
+	if !ok {
+		return
+	}
+
+	if target.Role != req.Role {
+		if err := config.GetDB().Model(target).Update("role", req.Role).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change role"})
+			return
+		}
+		target.Role = req.Role
+
+		h.postSystemMessage(c.Request.Context(), roomID, userID, username, fmt.Sprintf("%s made %s %s", username, targetUser.Username, req.Role))
+	}
+
+	c.JSON(http.StatusOK, target)
+}
+
+func (h *ChatHandler) RenameChatRoom(c *gin.Context) {
+	userID, username, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	roomID := c.Param("id")
+
+	var req models.RenameChatRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	room, actor, ok := h.findChatMember(c, roomID, userID)
+	if !ok {
+		return
+	}
+	if room.Type == "direct" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Direct chat rooms cannot be renamed"})
+		return
+	}
+	if actor.Role == models.ChatRoleMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only room owners and admins can rename the room"})
+		return
+	}
+
+	if err := config.GetDB().Model(room).Update("name", req.Name).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename chat room"})
+		return
+	}
+	room.Name = req.Name
+
+	h.postSystemMessage(c.Request.Context(), roomID, userID, username, fmt.Sprintf("%s renamed the room to %q", username, req.Name))
+
+	c.JSON(http.StatusOK, room)
+}
+
+func (h *ChatHandler) findChatMember(c *gin.Context, roomID, userID string) (*models.ChatRoom, *models.ChatRoomUser, bool) {
+	var participant models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).First(&participant).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant in this chat room"})
+		return nil, nil, false
+	}
+
+	var room models.ChatRoom
+	if err := config.GetDB().Where("id = ?", roomID).First(&room).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat room not found"})
+		return nil, nil, false
+	}
+
+	return &room, &participant, true
+}
+
+// findModeratedMember loads the participant named by the user_id path
+// parameter and checks that actor outranks them.
+func (h *ChatHandler) findModeratedMember(c *gin.Context, roomID string, actor *models.ChatRoomUser) (*models.ChatRoomUser, *models.User, bool) {
+	var target models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, c.Param("user_id")).First(&target).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Participant not found"})
+		return nil, nil, false
+	}
+
+	if !canModerate(actor, &target) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot manage this participant"})
+		return nil, nil, false
+	}
+
+	var targetUser models.User
+	if err := config.GetDB().Where("id = ?", target.UserID).First(&targetUser).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, nil, false
+	}
+
+	return &target, &targetUser, true
+}
+
+// postSystemMessage records a membership change in the room's history. It is
+// attributed to the user who made the change.
+func (h *ChatHandler) postSystemMessage(ctx context.Context, roomID, actorID, actorName, text string) {
+	if _, err := h.createMessage(ctx, roomID, actorID, actorName, models.ChatMessageRequest{
+		RoomID:      roomID,
+		Message:     text,
+		MessageType: "system",
+	}, nil); err != nil {
+		log.Printf("Failed to record system message: %v", err)
+	}
+}
+
+// disconnectMember closes a former participant's sockets on every instance.
+func (h *ChatHandler) disconnectMember(ctx context.Context, roomID, userID string) {
+	payload, err := json.Marshal(chatControl{Disconnect: userID})
+	if err != nil {
+		log.Printf("Failed to encode chat control: %v", err)
+		return
+	}
+	if err := h.broadcaster.Publish(ctx, chatControlPrefix+roomID, payload); err != nil {
+		log.Printf("Failed to broadcast chat control: %v", err)
+	}
+}
+
+func (h *ChatHandler) receive(topic string, payload []byte) {
+	roomID, isControl := strings.CutPrefix(topic, chatControlPrefix)
+	if !isControl {
+		h.hub.deliver(topic, payload)
+		return
+	}
+
+	var control chatControl
+	if err := json.Unmarshal(payload, &control); err != nil {
+		log.Printf("Ignoring malformed chat control: %v", err)
+		return
+	}
+	if control.Disconnect != "" {
+		h.hub.disconnectUser(roomID, control.Disconnect)
+	}
+}
@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxReactionRunes = 16
+
+func (h *ChatHandler) EditMessage(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var req models.EditChatMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message, ok := h.findAuthoredMessage(c, userID)
+	if !ok {
+		return
+	}
+
+	if req.Message == message.Message {
+		signAttachment(message.Attachment, userID)
+		c.JSON(http.StatusOK, message)
+		return
+	}
+
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.ChatMessageRevision{MessageID: message.ID, Message: message.Message}).Error; err != nil {
+			return err
+		}
+
+		editedAt := time.Now()
+		result := tx.Model(&models.ChatMessage{}).
+			Where("id = ? AND deleted_at IS NULL", message.ID).
+			Updates(map[string]interface{}{"message": req.Message, "edited_at": editedAt})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return newRequestError(http.StatusConflict, "Message has been deleted")
+		}
+
+		message.Message = req.Message
+		message.EditedAt = &editedAt
+		return nil
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to edit message")
+		return
+	}
+
+	if err := loadChatReactions(config.GetDB(), []*models.ChatMessage{message}); err != nil {
+		log.Printf("Failed to load chat reactions: %v", err)
+	}
+
+	h.publish(c.Request.Context(), message.RoomID, models.ChatEventMessageEdited, message)
+	signAttachment(message.Attachment, userID)
+
+	c.JSON(http.StatusOK, message)
+}
+
+// DeleteMessage blanks the message and drops its attachment but keeps the row,
+// so the conversation shows where it was. The text is not kept anywhere, not
+// even in the message's edit history or the recorded room events.
+func (h *ChatHandler) DeleteMessage(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	message, ok := h.findAuthoredMessage(c, userID)
+	if !ok {
+		return
+	}
+
+	attachment := message.Attachment
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		deletedAt := time.Now()
+		result := tx.Model(&models.ChatMessage{}).
+			Where("id = ? AND deleted_at IS NULL", message.ID).
+			Updates(map[string]interface{}{"message": "", "attachment_id": nil, "deleted_at": deletedAt})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return newRequestError(http.StatusConflict, "Message has already been deleted")
+		}
+
+		if attachment != nil {
+			if err := tx.Delete(attachment).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("message_id = ?", message.ID).Delete(&models.ChatMessageReaction{}).Error; err != nil {
+			return err
+		}
+		// Earlier versions go too: a deleted message keeps no text anywhere.
+		if err := tx.Where("message_id = ?", message.ID).Delete(&models.ChatMessageRevision{}).Error; err != nil {
+			return err
+		}
+
+		message.Message = ""
+		message.AttachmentID = nil
+		message.Attachment = nil
+		message.DeletedAt = &deletedAt
+		return scrubChatEvents(tx, message)
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to delete message")
+		return
+	}
+
+	if attachment != nil {
+		if err := h.blobs.Delete(c.Request.Context(), attachment.StorageKey); err != nil {
+			log.Printf("Failed to delete chat attachment %s: %v", attachment.StorageKey, err)
+		}
+	}
+
+	h.publish(c.Request.Context(), message.RoomID, models.ChatEventMessageDeleted, message)
+
+	c.JSON(http.StatusOK, message)
+}
+
+func (h *ChatHandler) GetMessageHistory(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	message, ok := h.findRoomMessage(c, userID)
+	if !ok {
+		return
+	}
+
+	var revisions []models.ChatMessageRevision
+	if err := config.GetDB().Where("message_id = ?", message.ID).Order("created_at ASC, id ASC").Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch message history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message, "revisions": revisions})
+}
+
+func (h *ChatHandler) AddReaction(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var req models.ChatReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	emoji, valid := normalizeReaction(req.Emoji)
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reaction must be an emoji"})
+		return
+	}
+
+	message, ok := h.findRoomMessage(c, userID)
+	if !ok {
+		return
+	}
+	if message.DeletedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Message has been deleted"})
+		return
+	}
+
+	reaction := models.ChatMessageReaction{MessageID: message.ID, UserID: userID, Emoji: emoji}
+	if err := config.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add reaction"})
+		return
+	}
+
+	h.respondWithReactions(c, message, userID, emoji, true)
+}
+
+func (h *ChatHandler) RemoveReaction(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	emoji, valid := normalizeReaction(c.Param("emoji"))
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reaction must be an emoji"})
+		return
+	}
+
+	message, ok := h.findRoomMessage(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := config.GetDB().Where("message_id = ? AND user_id = ? AND emoji = ?", message.ID, userID, emoji).Delete(&models.ChatMessageReaction{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove reaction"})
+		return
+	}
+
+	h.respondWithReactions(c, message, userID, emoji, false)
+}
+
+func (h *ChatHandler) respondWithReactions(c *gin.Context, message *models.ChatMessage, userID, emoji string, added bool) {
+	if err := loadChatReactions(config.GetDB(), []*models.ChatMessage{message}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reactions"})
+		return
+	}
+
+	event := models.ChatReactionEvent{
+		MessageID: message.ID,
+		UserID:    userID,
+		Emoji:     emoji,
+		Added:     added,
+		Reactions: message.Reactions,
+	}
+	if event.Reactions == nil {
+		event.Reactions = []models.ChatReactionCount{}
+	}
+	h.publish(c.Request.Context(), message.RoomID, models.ChatEventReaction, event)
+
+	c.JSON(http.StatusOK, event)
+}
+
+// findRoomMessage loads the message named in the path, provided the caller
+// takes part in its room.
+func (h *ChatHandler) findRoomMessage(c *gin.Context, userID string) (*models.ChatMessage, bool) {
+	var message models.ChatMessage
+	if err := config.GetDB().Preload("Attachment").Where("id = ?", c.Param("id")).First(&message).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return nil, false
+	}
+
+	var participant models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ? AND user_id = ?", message.RoomID, userID).First(&participant).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant in this chat room"})
+		return nil, false
+	}
+
+	return &message, true
+}
+
+func (h *ChatHandler) findAuthoredMessage(c *gin.Context, userID string) (*models.ChatMessage, bool) {
+	message, ok := h.findRoomMessage(c, userID)
+	if !ok {
+		return nil, false
+	}
+	if message.UserID != userID || message.MessageType == "system" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only change your own messages"})
+		return nil, false
+	}
+	if message.DeletedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Message has been deleted"})
+		return nil, false
+	}
+	return message, true
+}
+
+// normalizeReaction accepts a single emoji (including sequences joined with
+// ZWJ or modifiers, flags and keycaps) and rejects ASCII outside a keycap and
+// anything longer than one emoji, so reactions cannot be used as a side
+// channel for free text.
+func normalizeReaction(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || !utf8.ValidString(value) || utf8.RuneCountInString(value) > maxReactionRunes {
+		return "", false
+	}
+
+	runes := []rune(value)
+	emoji := 0
+	flagStarted := false
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		pairsFlag := flagStarted
+		flagStarted = false
+		switch {
+		case r == '#' || r == '*' || (r >= '0' && r <= '9'):
+			// Only as the base of a keycap such as 1️⃣.
+			if i+1 == len(runes) || (runes[i+1] != 0xFE0F && runes[i+1] != 0x20E3) {
+				return "", false
+			}
+			emoji++
+		case r < utf8.RuneSelf:
+			return "", false
+		case emojiModifier(r):
+			if i == 0 {
+				return "", false
+			}
+		case r == 0x200D:
+			// A zero width joiner glues the next character into this emoji.
+			if i == 0 || i+1 == len(runes) || runes[i+1] < utf8.RuneSelf {
+				return "", false
+			}
+			i++
+		case r >= 0x1F1E6 && r <= 0x1F1FF:
+			// Flags are pairs of regional indicators.
+			if !pairsFlag {
+				emoji++
+				flagStarted = true
+			}
+		default:
+			emoji++
+		}
+	}
+	if emoji != 1 {
+		return "", false
+	}
+	return value, true
+}
+
+// emojiModifier reports whether r changes the character before it rather
+// than starting a new one: variation selectors, the keycap mark, skin tones
+// and the tags of subdivision flags.
+func emojiModifier(r rune) bool {
+	return (r >= 0xFE00 && r <= 0xFE0F) ||
+		r == 0x20E3 ||
+		(r >= 0x1F3FB && r <= 0x1F3FF) ||
+		(r >= 0xE0020 && r <= 0xE007F)
+}
+
+// loadChatReactions fills in the per-emoji reaction counts of messages.
+func loadChatReactions(db *gorm.DB, messages []*models.ChatMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(messages))
+	byID := make(map[string]*models.ChatMessage, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+		byID[message.ID] = message
+		message.Reactions = nil
+	}
+
+	var reactions []models.ChatMessageReaction
+	if err := db.Where("message_id IN ?", ids).Order("created_at ASC, id ASC").Find(&reactions).Error; err != nil {
+		return err
+	}
+
+	for _, reaction := range reactions {
+		message := byID[reaction.MessageID]
+		found := false
+		for i := range message.Reactions {
+			if message.Reactions[i].Emoji == reaction.Emoji {
+				message.Reactions[i].Count++
+				message.Reactions[i].UserIDs = append(message.Reactions[i].UserIDs, reaction.UserID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			message.Reactions = append(message.Reactions, models.ChatReactionCount{
+				Emoji:   reaction.Emoji,
+				Count:   1,
+				UserIDs: []string{reaction.UserID},
+			})
+		}
+	}
+
+	return nil
+}
+
+func loadChatReactionsForList(db *gorm.DB, messages []models.ChatMessage) error {
+	pointers := make([]*models.ChatMessage, len(messages))
+	for i := range messages {
+		pointers[i] = &messages[i]
+	}
+	return loadChatReactions(db, pointers)
+}
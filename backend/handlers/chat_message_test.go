@@ -0,0 +1,48 @@
+package handlers
+
+import "testing"
+
+func TestNormalizeReaction(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+		valid bool
+	}{
+		{"emoji", "👍", "👍", true},
+		{"trimmed", "  🎉\n", "🎉", true},
+		{"skin tone modifier", "👍🏽", "👍🏽", true},
+		{"ZWJ sequence", "👩‍💻", "👩‍💻", true},
+		{"flag", "🇵🇱", "🇵🇱", true},
+		{"keycap", "1️⃣", "1️⃣", true},
+		{"hash keycap", "#️⃣", "#️⃣", true},
+		{"empty", "", "", false},
+		{"blank", "   ", "", false},
+		{"letters", "ok", "", false},
+		{"emoji with text", "👍 nice", "", false},
+		{"markup", "<b>", "", false},
+		{"invalid UTF-8", "\xff\xfe", "", false},
+		{"family", "👨‍👩‍👧‍👦", "👨‍👩‍👧‍👦", true},
+		{"keycap without selector", "1⃣", "1⃣", true},
+		{"subdivision flag", "🏴󠁧󠁢󠁳󠁣󠁴󠁿", "🏴󠁧󠁢󠁳󠁣󠁴󠁿", true},
+		{"digits", "1234567890123456", "", false},
+		{"bare digit", "7", "", false},
+		{"hash", "#", "", false},
+		{"digits after keycap", "1️⃣23", "", false},
+		{"two emoji", "👍👎", "", false},
+		{"two flags", "🇵🇱🇩🇪", "", false},
+		{"lone modifier", "🏽", "", false},
+		{"trailing joiner", "👩‍", "", false},
+		{"joined letter", "👩‍a", "", false},
+		{"too long", "😀😀😀😀😀😀😀😀😀😀😀😀😀😀😀😀😀", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, valid := normalizeReaction(tt.value)
+			if got != tt.want || valid != tt.valid {
+				t.Errorf("normalizeReaction(%q) = %q, %v; want %q, %v", tt.value, got, valid, tt.want, tt.valid)
+			}
+		})
+	}
+}
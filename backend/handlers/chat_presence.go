@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// chatPresenceTTL is how long a presence row stays online without a
+// heartbeat, so users connected to a crashed instance eventually go offline.
+// It must comfortably exceed the interval given to RunPresenceHeartbeat.
+const chatPresenceTTL = 90 * time.Second
+
+// chatPresence counts this instance's connections per user and mirrors the
+// counts into chat_presences, where every instance can see them.
+type chatPresence struct {
+	instanceID  string
+	mutex       sync.Mutex
+	connections map[string]int
+}
+
+func newChatPresence() *chatPresence {
+	return &chatPresence{
+		instanceID:  uuid.New().String(),
+		connections: make(map[string]int),
+	}
+}
+
+// connect records a new connection and reports whether it is the user's first
+// on this instance.
+func (p *chatPresence) connect(db *gorm.DB, userID string) (bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.connections[userID]++
+	return p.connections[userID] == 1, p.save(db, userID, p.connections[userID])
+}
+
+// disconnect records a closed connection and reports whether it was the
+// user's last on this instance.
+func (p *chatPresence) disconnect(db *gorm.DB, userID string) (bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.connections[userID]--
+	count := p.connections[userID]
+	if count <= 0 {
+		delete(p.connections, userID)
+		count = 0
+	}
+	return count == 0, p.save(db, userID, count)
+}
+
+func (p *chatPresence) save(db *gorm.DB, userID string, connections int) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "instance_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"connections", "last_seen_at"}),
+	}).Create(&models.ChatPresence{
+		UserID:      userID,
+		InstanceID:  p.instanceID,
+		Connections: connections,
+		LastSeenAt:  time.Now(),
+	}).Error
+}
+
+func (p *chatPresence) heartbeat(db *gorm.DB) error {
+	return db.Model(&models.ChatPresence{}).
+		Where("instance_id = ? AND connections > 0", p.instanceID).
+		Update("last_seen_at", time.Now()).Error
+}
+
+func chatUserOnline(db *gorm.DB, userID string) (bool, error) {
+	var count int64
+	err := db.Model(&models.ChatPresence{}).
+		Where("user_id = ? AND connections > 0 AND last_seen_at > ?", userID, time.Now().Add(-chatPresenceTTL)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func chatRoomPresence(db *gorm.DB, roomID string) ([]models.ChatPresenceStatus, error) {
+	statuses := []models.ChatPresenceStatus{}
+	err := db.Raw(`
+		SELECT cru.user_id, u.username AS user_name,
+			COALESCE(BOOL_OR(p.connections > 0 AND p.last_seen_at > ?), false) AS online,
+			MAX(p.last_seen_at) AS last_seen_at
+		FROM chat_room_users cru
+		JOIN users u ON u.id = cru.user_id
+		LEFT JOIN chat_presences p ON p.user_id = cru.user_id
+		WHERE cru.room_id = ?
+		GROUP BY cru.user_id, u.username
+		ORDER BY u.username`, time.Now().Add(-chatPresenceTTL), roomID).
+		Scan(&statuses).Error
+	return statuses, err
+}
+
+// RunPresenceHeartbeat keeps this instance's presence rows fresh until ctx is
+// cancelled.
+func (h *ChatHandler) RunPresenceHeartbeat(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := h.presence.heartbeat(config.GetDB()); err != nil {
+				log.Printf("Failed to refresh chat presence: %v", err)
+			}
+		}
+	}
+}
+
+// announcePresence tells every room the user belongs to that they came online
+// or went offline.
+func (h *ChatHandler) announcePresence(ctx context.Context, userID, username string, online bool) {
+	var roomIDs []string
+	if err := config.GetDB().Model(&models.ChatRoomUser{}).Where("user_id = ?", userID).Pluck("room_id", &roomIDs).Error; err != nil {
+		log.Printf("Failed to load chat rooms for presence: %v", err)
+		return
+	}
+
+	now := time.Now()
+	status := models.ChatPresenceStatus{UserID: userID, UserName: username, Online: online, LastSeenAt: &now}
+	for _, roomID := range roomIDs {
+		h.publish(ctx, roomID, models.ChatEventPresence, status)
+	}
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/models"
+	"shopsphere-backend/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	chatRetentionBatch   = 500
+	chatRetentionTimeout = 2 * time.Minute
+)
+
+var chatRoomTypes = []string{"direct", "group"}
+
+// ChatRetention archives and purges messages older than the retention period
+// of their room type.
+type ChatRetention struct {
+	policy config.ChatRetentionConfig
+	blobs  storage.BlobStore
+}
+
+func NewChatRetention(policy config.ChatRetentionConfig, blobs storage.BlobStore) *ChatRetention {
+	return &ChatRetention{policy: policy, blobs: blobs}
+}
+
+// chatArchivedMessage is one line of an archive: the message as the API
+// returns it, plus everything purged along with it.
+type chatArchivedMessage struct {
+	models.ChatMessage
+	RoomType  string                       `json:"room_type"`
+	Revisions []models.ChatMessageRevision `json:"revisions,omitempty"`
+}
+
+// Run purges expired messages every interval until ctx is cancelled. It
+// returns straight away when no room type has a retention period.
+func (r *ChatRetention) Run(ctx context.Context, interval time.Duration) {
+	if r.policy.Direct == 0 && r.policy.Group == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := r.Purge(ctx)
+			if err != nil {
+				log.Printf("Chat retention failed: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("Archived and purged %d expired chat messages", purged)
+			}
+		}
+	}
+}
+
+// Report counts what Purge would remove right now without changing anything.
+func (r *ChatRetention) Report(ctx context.Context) (*models.ChatRetentionReport, error) {
+	now := time.Now()
+	report := &models.ChatRetentionReport{
+		GeneratedAt: now,
+		RoomTypes:   make([]models.ChatRetentionRoomTypeStat, 0, len(chatRoomTypes)),
+	}
+
+	for _, roomType := range chatRoomTypes {
+		keep := r.policy.ForRoomType(roomType)
+		stat := models.ChatRetentionRoomTypeStat{
+			RoomType:      roomType,
+			RetentionDays: int(keep / (24 * time.Hour)),
+		}
+
+		if keep > 0 {
+			cutoff := now.Add(-keep)
+			stat.Cutoff = &cutoff
+
+			var counts struct {
+				Messages        int64
+				Rooms           int64
+				Attachments     int64
+				AttachmentBytes int64
+				OldestMessageAt *time.Time
+			}
+			err := config.GetDB().WithContext(ctx).Raw(`
+				SELECT COUNT(*) AS messages,
+					COUNT(DISTINCT m.room_id) AS rooms,
+					COUNT(a.id) AS attachments,
+					COALESCE(SUM(a.size), 0) AS attachment_bytes,
+					MIN(m.created_at) AS oldest_message_at
+				FROM chat_messages m
+				JOIN chat_rooms r ON r.id = m.room_id
+				LEFT JOIN chat_attachments a ON a.id = m.attachment_id
+				WHERE r.type = ? AND m.created_at < ?`, roomType, cutoff).
+				Scan(&counts).Error
+			if err != nil {
+				return nil, err
+			}
+			stat.Messages = counts.Messages
+			stat.Rooms = counts.Rooms
+			stat.Attachments = counts.Attachments
+			stat.AttachmentBytes = counts.AttachmentBytes
+			stat.OldestMessageAt = counts.OldestMessageAt
+		}
+
+		report.RoomTypes = append(report.RoomTypes, stat)
+	}
+
+	return report, nil
+}
+
+// Purge archives and deletes every expired message in batches. Batches are
+// claimed with SKIP LOCKED so several instances can purge at once.
+func (r *ChatRetention) Purge(ctx context.Context) (int, error) {
+	total := 0
+	for _, roomType := range chatRoomTypes {
+		keep := r.policy.ForRoomType(roomType)
+		if keep == 0 {
+			continue
+		}
+		cutoff := time.Now().Add(-keep)
+
+		for {
+			purged, err := r.purgeBatch(ctx, roomType, cutoff)
+			total += purged
+			if err != nil {
+				return total, err
+			}
+			if purged < chatRetentionBatch {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// purgeBatch writes one batch to the blob store before deleting it, in the
+// same transaction, so a message is only gone once its archive exists.
+// Attachment files are deleted rather than archived; the archive keeps their
+// metadata.
+func (r *ChatRetention) purgeBatch(ctx context.Context, roomType string, cutoff time.Time) (int, error) {
+	batchCtx, cancel := context.WithTimeout(ctx, chatRetentionTimeout)
+	defer cancel()
+
+	var attachments []models.ChatAttachment
+	purged := 0
+	err := config.GetDB().WithContext(batchCtx).Transaction(func(tx *gorm.DB) error {
+		var messages []models.ChatMessage
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("room_id IN (SELECT id FROM chat_rooms WHERE type = ?) AND created_at < ?", roomType, cutoff).
+			Order("created_at ASC, id ASC").
+			Limit(chatRetentionBatch).
+			Find(&messages).Error; err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		ids := make([]string, len(messages))
+		var attachmentIDs []string
+		for i, message := range messages {
+			ids[i] = message.ID
+			if message.AttachmentID != nil {
+				attachmentIDs = append(attachmentIDs, *message.AttachmentID)
+			}
+		}
+
+		if len(attachmentIDs) > 0 {
+			if err := tx.Where("id IN ?", attachmentIDs).Find(&attachments).Error; err != nil {
+				return err
+			}
+		}
+		var revisions []models.ChatMessageRevision
+		if err := tx.Where("message_id IN ?", ids).Order("created_at ASC, id ASC").Find(&revisions).Error; err != nil {
+			return err
+		}
+		if err := loadChatReactionsForList(tx, messages); err != nil {
+			return err
+		}
+
+		if err := r.archive(batchCtx, roomType, messages, attachments, revisions); err != nil {
+			return err
+		}
+
+		if err := tx.Where("message_id IN ?", ids).Delete(&models.ChatMessageReaction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id IN ?", ids).Delete(&models.ChatMessageRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&models.ChatMessage{}).Error; err != nil {
+			return err
+		}
+		if len(attachmentIDs) > 0 {
+			if err := tx.Where("id IN ?", attachmentIDs).Delete(&models.ChatAttachment{}).Error; err != nil {
+				return err
+			}
+		}
+
+		purged = len(messages)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, attachment := range attachments {
+		if err := r.blobs.Delete(ctx, attachment.StorageKey); err != nil {
+			log.Printf("Failed to delete chat attachment %s: %v", attachment.StorageKey, err)
+		}
+	}
+
+	return purged, nil
+}
+
+// archive stores a batch as gzipped JSON lines under chat-archive/, keyed by
+// date and first message so retrying a failed batch overwrites its archive.
+func (r *ChatRetention) archive(ctx context.Context, roomType string, messages []models.ChatMessage, attachments []models.ChatAttachment, revisions []models.ChatMessageRevision) error {
+	attachmentsByID := make(map[string]*models.ChatAttachment, len(attachments))
+	for i := range attachments {
+		attachmentsByID[attachments[i].ID] = &attachments[i]
+	}
+	revisionsByMessage := make(map[string][]models.ChatMessageRevision)
+	for _, revision := range revisions {
+		revisionsByMessage[revision.MessageID] = append(revisionsByMessage[revision.MessageID], revision)
+	}
+
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	encoder := json.NewEncoder(gz)
+	for _, message := range messages {
+		if message.AttachmentID != nil {
+			message.Attachment = attachmentsByID[*message.AttachmentID]
+		}
+		record := chatArchivedMessage{
+			ChatMessage: message,
+			RoomType:    roomType,
+			Revisions:   revisionsByMessage[message.ID],
+		}
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("chat-archive/%s/%s/%s.jsonl.gz", roomType, time.Now().UTC().Format("2006/01/02"), messages[0].ID)
+	return r.blobs.Put(ctx, key, &buffer, int64(buffer.Len()), "application/gzip")
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chatSearchOrder lists matches newest first.
+var chatSearchOrder = keysetOrder{name: "newest", keyExpr: "chat_messages.created_at", idColumn: "chat_messages.id", desc: true}
+
+// chatTranscriptOrder walks a room from its first message.
+var chatTranscriptOrder = keysetOrder{name: "oldest", keyExpr: "created_at", idColumn: "id"}
+
+const chatTranscriptBatchSize = 500
+
+var chatSearchColumns = "chat_messages.*, chat_rooms.name AS room_name" +
+	", ts_headline('" + config.SearchConfig + "', chat_messages.message, search_query, 'MaxFragments=1, MaxWords=25, MinWords=8, StartSel=" + headlineStart + ", StopSel=" + headlineStop + "') AS snippet"
+
+// SearchMessages finds messages matching q in every room the caller takes
+// part in, or only in room_id. Deleted and system messages are not searched.
+func (h *ChatHandler) SearchMessages(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	search := strings.TrimSpace(c.Query("q"))
+	if search == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is required"})
+		return
+	}
+
+	cursor, _, err := cursorRequest(c, chatSearchOrder)
+	if err != nil {
+		respondWithError(c, err, "Failed to search messages")
+		return
+	}
+	limit := cursorLimit(c, 20)
+
+	query := config.GetDB().Model(&models.ChatMessage{}).
+		Select(chatSearchColumns).
+		Joins("JOIN chat_room_users ON chat_room_users.room_id = chat_messages.room_id AND chat_room_users.user_id = ?", userID).
+		Joins("JOIN chat_rooms ON chat_rooms.id = chat_messages.room_id").
+		Joins("CROSS JOIN websearch_to_tsquery('"+config.SearchConfig+"', ?) AS search_query", search).
+		Where("chat_messages.search_vector @@ search_query").
+		Where("chat_messages.deleted_at IS NULL AND chat_messages.message_type <> 'system'")
+	if roomID := c.Query("room_id"); roomID != "" {
+		query = query.Where("chat_messages.room_id = ?", roomID)
+	}
+
+	var messages []models.ChatMessage
+	if err := chatSearchOrder.apply(query, cursor).Preload("Attachment").Limit(limit + 1).Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search messages"})
+		return
+	}
+
+	messages, pagination := keysetPage(messages, limit, cursor, chatSearchOrder, func(message models.ChatMessage) (interface{}, string) {
+		return message.CreatedAt, message.ID
+	})
+
+	for i := range messages {
+		messages[i].Snippet = renderHeadline(messages[i].Snippet)
+	}
+	signMessageAttachments(messages, userID)
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages, "pagination": pagination})
+}
+
+// ExportTranscript writes the whole room as a download in the format given by
+// the format query parameter: json (default), csv or txt. Messages are read
+// in batches so long conversations are never held in memory at once.
+func (h *ChatHandler) ExportTranscript(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	roomID := c.Param("id")
+
+	var participant models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).First(&participant).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant in this chat room"})
+		return
+	}
+
+	var room models.ChatRoom
+	if err := config.GetDB().Where("id = ?", roomID).First(&room).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat room not found"})
+		return
+	}
+
+	var writer transcriptWriter
+	switch format := c.DefaultQuery("format", "json"); format {
+	case "json":
+		writer = &jsonTranscript{}
+	case "csv":
+		writer = &csvTranscript{}
+	case "txt", "text":
+		writer = &textTranscript{}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be json, csv or txt"})
+		return
+	}
+
+	c.Header("Content-Type", writer.contentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="chat-%s.%s"`, room.ID, writer.extension()))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	exportedAt := time.Now().UTC()
+	if err := writer.begin(c.Writer, &room, exportedAt); err != nil {
+		return
+	}
+
+	var cursor *pageCursor
+	for {
+		var messages []models.ChatMessage
+		query := config.GetDB().Preload("Attachment").Where("room_id = ?", roomID)
+		if err := chatTranscriptOrder.apply(query, cursor).Limit(chatTranscriptBatchSize).Find(&messages).Error; err != nil {
+			// The status line is already sent, so all we can do is stop.
+			log.Printf("Failed to export chat room %s: %v", roomID, err)
+			return
+		}
+
+		for i := range messages {
+			if err := writer.write(c.Writer, &messages[i]); err != nil {
+				return
+			}
+		}
+
+		if len(messages) < chatTranscriptBatchSize {
+			break
+		}
+		last := messages[len(messages)-1]
+		cursor = &pageCursor{Key: last.CreatedAt, ID: last.ID}
+	}
+
+	writer.end(c.Writer)
+}
+
+type transcriptWriter interface {
+	contentType() string
+	extension() string
+	begin(w gin.ResponseWriter, room *models.ChatRoom, exportedAt time.Time) error
+	write(w gin.ResponseWriter, message *models.ChatMessage) error
+	end(w gin.ResponseWriter)
+}
+
+type jsonTranscript struct {
+	count int
+}
+
+func (t *jsonTranscript) contentType() string { return "application/json; charset=utf-8" }
+func (t *jsonTranscript) extension() string   { return "json" }
+
+func (t *jsonTranscript) begin(w gin.ResponseWriter, room *models.ChatRoom, exportedAt time.Time) error {
+	header, err := json.Marshal(gin.H{"chat_room": room, "exported_at": exportedAt})
+	if err != nil {
+		return err
+	}
+	// Reopen the header object to append the messages array to it.
+	_, err = fmt.Fprintf(w, `%s,"messages":[`, header[:len(header)-1])
+	return err
+}
+
+func (t *jsonTranscript) write(w gin.ResponseWriter, message *models.ChatMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if t.count > 0 {
+		if _, err := w.WriteString(","); err != nil {
+			return err
+		}
+	}
+	t.count++
+	_, err = w.Write(data)
+	return err
+}
+
+func (t *jsonTranscript) end(w gin.ResponseWriter) {
+	w.WriteString("]}")
+}
+
+type csvTranscript struct {
+	csv *csv.Writer
+}
+
+func (t *csvTranscript) contentType() string { return "text/csv; charset=utf-8" }
+func (t *csvTranscript) extension() string   { return "csv" }
+
+func (t *csvTranscript) begin(w gin.ResponseWriter, room *models.ChatRoom, exportedAt time.Time) error {
+	t.csv = csv.NewWriter(w)
+	return t.csv.Write([]string{"id", "created_at", "user_id", "user_name", "message_type", "message", "attachment", "edited_at", "deleted_at"})
+}
+
+func (t *csvTranscript) write(w gin.ResponseWriter, message *models.ChatMessage) error {
+	attachment := ""
+	if message.Attachment != nil {
+		attachment = message.Attachment.FileName
+	}
+	err := t.csv.Write([]string{
+		message.ID,
+		message.CreatedAt.UTC().Format(time.RFC3339),
+		message.UserID,
+		csvSafe(message.UserName),
+		message.MessageType,
+		csvSafe(message.Message),
+		csvSafe(attachment),
+		formatTranscriptTime(message.EditedAt),
+		formatTranscriptTime(message.DeletedAt),
+	})
+	if err != nil {
+		return err
+	}
+	t.csv.Flush()
+	return t.csv.Error()
+}
+
+func (t *csvTranscript) end(w gin.ResponseWriter) {
+	t.csv.Flush()
+}
+
+// csvSafe stops spreadsheet applications from evaluating user-written cells
+// as formulas.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+type textTranscript struct{}
+
+func (t *textTranscript) contentType() string { return "text/plain; charset=utf-8" }
+func (t *textTranscript) extension() string   { return "txt" }
+
+func (t *textTranscript) begin(w gin.ResponseWriter, room *models.ChatRoom, exportedAt time.Time) error {
+	_, err := fmt.Fprintf(w, "%s\nExported %s\n\n", transcriptText(room.Name), exportedAt.Format(time.RFC3339))
+	return err
+}
+
+func (t *textTranscript) write(w gin.ResponseWriter, message *models.ChatMessage) error {
+	var line strings.Builder
+	line.WriteString("[" + message.CreatedAt.UTC().Format("2006-01-02 15:04:05") + "] ")
+
+	switch {
+	case message.DeletedAt != nil:
+		line.WriteString(transcriptText(message.UserName) + ": [message deleted]")
+	case message.MessageType == "system":
+		line.WriteString("* " + transcriptText(message.Message))
+	default:
+		line.WriteString(transcriptText(message.UserName) + ": " + transcriptText(message.Message))
+		if message.Attachment != nil && message.Attachment.FileName != message.Message {
+			line.WriteString(" [attachment: " + transcriptText(message.Attachment.FileName) + "]")
+		}
+		if message.EditedAt != nil {
+			line.WriteString(" (edited)")
+		}
+	}
+	line.WriteString("\n")
+
+	_, err := w.WriteString(line.String())
+	return err
+}
+
+func (t *textTranscript) end(w gin.ResponseWriter) {}
+
+// transcriptLineBreaks indents every line after the first of a multi-line
+// value, so that no line inside a message can pass for the start of another.
+// It covers the breaks text editors honour besides \n.
+var transcriptLineBreaks = strings.NewReplacer(
+	"\r\n", "\n    ",
+	"\r", "\n    ",
+	"\n", "\n    ",
+	"\v", "\n    ",
+	"\f", "\n    ",
+	"\u0085", "\n    ",
+	"\u2028", "\n    ",
+	"\u2029", "\n    ",
+)
+
+func transcriptText(value string) string {
+	return transcriptLineBreaks.Replace(value)
+}
+
+func formatTranscriptTime(value *time.Time) string {
+	if value == nil {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import "testing"
+
+func TestCSVSafe(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"hello", "hello"},
+		{"=SUM(A1:A2)", "'=SUM(A1:A2)"},
+		{"+48 123", "'+48 123"},
+		{"-1", "'-1"},
+		{"@user", "'@user"},
+		{"\tindented", "'\tindented"},
+		{"\rreturn", "'\rreturn"},
+		{"a=b", "a=b"},
+		{" =SUM(A1)", " =SUM(A1)"},
+		{"'quoted", "'quoted"},
+	}
+
+	for _, tt := range tests {
+		if got := csvSafe(tt.value); got != tt.want {
+			t.Errorf("csvSafe(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestTranscriptText(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"hello", "hello"},
+		{"", ""},
+		{"two\nlines", "two\n    lines"},
+		{"hi\n[2026-01-01 00:00:00] admin: send me your password", "hi\n    [2026-01-01 00:00:00] admin: send me your password"},
+		{"windows\r\nbreak", "windows\n    break"},
+		{"old mac\rbreak", "old mac\n    break"},
+		{"trailing\n", "trailing\n    "},
+		{"line\u2028separator", "line\n    separator"},
+		{"next\u0085line", "next\n    line"},
+		{"form\ffeed", "form\n    feed"},
+	}
+
+	for _, tt := range tests {
+		if got := transcriptText(tt.value); got != tt.want {
+			t.Errorf("transcriptText(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
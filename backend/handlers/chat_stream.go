@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	chatEventRetention  = 24 * time.Hour
+	chatStreamReplayMax = 500
+	chatStreamRetry     = 3 * time.Second
+)
+
+// chatStreamReplayWindow is how far behind Last-Event-ID a resume looks again.
+// Event IDs are taken when the row is inserted, not when it commits, so an
+// event can become visible after a higher ID was already sent.
+const chatStreamReplayWindow = 5 * time.Second
+
+// chatEphemeralEvents are only worth delivering live, so they are neither
+// recorded nor given an ID and are not replayed on resume.
+var chatEphemeralEvents = map[string]bool{
+	models.ChatEventTyping:   true,
+	models.ChatEventPresence: true,
+	models.ChatEventError:    true,
+}
+
+func recordChatEvent(roomID, eventType string, data interface{}) (int64, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+
+	record := models.ChatEventRecord{RoomID: roomID, Type: eventType, Payload: string(payload)}
+	if err := config.GetDB().Create(&record).Error; err != nil {
+		return 0, err
+	}
+	return record.ID, nil
+}
+
+// scrubChatEvents overwrites the recorded events that carry message with its
+// current, deleted form, so a resuming stream cannot replay deleted text.
+func scrubChatEvents(tx *gorm.DB, message *models.ChatMessage) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&models.ChatEventRecord{}).
+		Where("room_id = ? AND type IN ? AND payload->>'id' = ?", message.RoomID, []string{models.ChatEventMessage, models.ChatEventMessageEdited}, message.ID).
+		Update("payload", string(payload)).Error
+}
+
+// StreamEvents is the Server-Sent Events fallback for clients that cannot
+// keep a WebSocket open. It carries the same envelopes as the WebSocket, each
+// as an unnamed event whose SSE id is the envelope's id, and replays what was
+// missed when the client reconnects with Last-Event-ID. Clients send through
+// the REST endpoints.
+func (h *ChatHandler) StreamEvents(c *gin.Context) {
+	userID, username, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	roomID := c.Param("id")
+
+	var participant models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).First(&participant).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant in this chat room"})
+		return
+	}
+
+	lastEventID, resuming, valid := chatLastEventID(c)
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+		return
+	}
+
+	// Register before replaying so nothing published in between is lost;
+	// frames the replay already sent are skipped below. Live frames queue up
+	// while the replay is written, so the buffer has room for a whole replay
+	// on top of the usual backlog.
+	client := newChatClient(nil, roomID, userID, chatSendBufferSize+chatStreamReplayMax)
+	h.hub.register(client)
+	defer h.hub.unregister(client)
+
+	ctx := c.Request.Context()
+	h.connectPresence(context.Background(), userID, username)
+	defer h.disconnectPresence(context.Background(), userID, username)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", chatStreamRetry.Milliseconds())
+	c.Writer.Flush()
+
+	var replayed map[int64]bool
+	if resuming {
+		replayed = h.replayChatEvents(c, roomID, lastEventID)
+	}
+
+	keepAlive := time.NewTicker(chatPingPeriod)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case frame, ok := <-client.send:
+			if !ok {
+				return
+			}
+			id := chatFrameID(frame)
+			if replayed[id] {
+				continue
+			}
+			writeChatStreamEvent(c, id, frame)
+		case <-keepAlive.C:
+			io.WriteString(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+// replayChatEvents sends the room's recorded events after lastEventID, and
+// again those recorded shortly before it, and returns the IDs it sent. The
+// client drops repeats by envelope id. When the gap is too old or too long to
+// replay, the client is told to resync instead.
+func (h *ChatHandler) replayChatEvents(c *gin.Context, roomID string, lastEventID int64) map[int64]bool {
+	var oldest int64
+	if err := config.GetDB().Model(&models.ChatEventRecord{}).Select("COALESCE(MIN(id), 0)").Scan(&oldest).Error; err != nil {
+		log.Printf("Failed to check chat event log: %v", err)
+	}
+
+	var records []models.ChatEventRecord
+	err := config.GetDB().
+		Where("room_id = ? AND (id > ? OR created_at >= (SELECT created_at FROM chat_events WHERE id = ?) - make_interval(secs => ?))",
+			roomID, lastEventID, lastEventID, chatStreamReplayWindow.Seconds()).
+		Order("id ASC").
+		Limit(chatStreamReplayMax + 1).
+		Find(&records).Error
+	if err != nil || len(records) > chatStreamReplayMax || oldest > lastEventID+1 {
+		if err != nil {
+			log.Printf("Failed to replay chat events: %v", err)
+		}
+		h.writeChatResync(c, roomID)
+		return nil
+	}
+
+	replayed := make(map[int64]bool, len(records))
+	for _, record := range records {
+		frame, err := json.Marshal(models.ChatEvent{
+			ID:     record.ID,
+			Type:   record.Type,
+			RoomID: record.RoomID,
+			Data:   json.RawMessage(record.Payload),
+		})
+		if err != nil {
+			log.Printf("Failed to encode chat event %d: %v", record.ID, err)
+			continue
+		}
+		writeChatStreamEvent(c, record.ID, frame)
+		replayed[record.ID] = true
+	}
+	return replayed
+}
+
+func (h *ChatHandler) writeChatResync(c *gin.Context, roomID string) {
+	frame, err := json.Marshal(models.ChatEvent{Type: models.ChatEventResync, RoomID: roomID, Data: struct{}{}})
+	if err != nil {
+		return
+	}
+	writeChatStreamEvent(c, 0, frame)
+}
+
+func writeChatStreamEvent(c *gin.Context, id int64, frame []byte) {
+	event := sse.Event{Data: string(frame)}
+	if id != 0 {
+		event.Id = strconv.FormatInt(id, 10)
+	}
+	c.Render(-1, event)
+	c.Writer.Flush()
+}
+
+// chatLastEventID reads the resume point from the Last-Event-ID header that
+// EventSource sends on reconnect, or from a last_event_id query parameter for
+// clients resuming a fresh connection.
+func chatLastEventID(c *gin.Context) (id int64, resuming, valid bool) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("last_event_id")
+	}
+	if value == "" {
+		return 0, false, true
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false, false
+	}
+	return id, true, true
+}
+
+func chatFrameID(frame []byte) int64 {
+	var envelope struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(frame, &envelope); err != nil {
+		return 0
+	}
+	return envelope.ID
+}
+
+// SendTyping lets stream clients, which have no socket to send on, report
+// that the user is typing.
+func (h *ChatHandler) SendTyping(c *gin.Context) {
+	userID, username, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	roomID := c.Param("id")
+
+	var req models.ChatTyping
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var participant models.ChatRoomUser
+	if err := config.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).First(&participant).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant in this chat room"})
+		return
+	}
+
+	h.publish(c.Request.Context(), roomID, models.ChatEventTyping, models.ChatTyping{
+		UserID:   userID,
+		UserName: username,
+		Typing:   req.Typing,
+	})
+
+	c.Status(http.StatusNoContent)
+}
+
+// RunEventPruner deletes recorded chat events once they are too old to be
+// worth replaying, until ctx is cancelled.
+func (h *ChatHandler) RunEventPruner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cutoff := time.Now().Add(-chatEventRetention)
+			if err := config.GetDB().Where("created_at < ?", cutoff).Delete(&models.ChatEventRecord{}).Error; err != nil {
+				log.Printf("Failed to prune chat events: %v", err)
+			}
+		}
+	}
+}
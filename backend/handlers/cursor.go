@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// pageCursor is the decoded form of the opaque next_cursor/prev_cursor
+// strings: the sort key and ID of the row the page starts after, and whether
+// the client is paging backwards from it.
+type pageCursor struct {
+	Sort     string      `json:"s,omitempty"`
+	Key      interface{} `json:"k"`
+	ID       string      `json:"id"`
+	Backward bool        `json:"b,omitempty"`
+}
+
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.ID == "" {
+		return nil, errors.New("cursor is missing its row ID")
+	}
+	return &cursor, nil
+}
+
+// keysetOrder is a list ordering usable for keyset pagination: rows are
+// sorted by keyExpr and then idColumn, both in the same direction, so the
+// pair is unique and a row comparison picks up exactly where a page ended.
+// Sort keys are timestamps unless numeric is set.
+type keysetOrder struct {
+	name     string
+	keyExpr  string
+	idColumn string
+	desc     bool
+	numeric  bool
+}
+
+// checkKey makes sure a decoded cursor carries the kind of key and ID the
+// order compares against, so a crafted cursor cannot make the query fail.
+// Timestamps come back from JSON as strings and are parsed here.
+func (o keysetOrder) checkKey(cursor *pageCursor) error {
+	if _, err := uuid.Parse(cursor.ID); err != nil {
+		return errors.New("cursor row ID is not a UUID")
+	}
+
+	if o.numeric {
+		if _, ok := cursor.Key.(float64); !ok {
+			return errors.New("cursor key is not a number")
+		}
+		return nil
+	}
+
+	value, ok := cursor.Key.(string)
+	if !ok {
+		return errors.New("cursor key is not a timestamp")
+	}
+	key, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return err
+	}
+	cursor.Key = key
+	return nil
+}
+
+func (o keysetOrder) clause(reverse bool) string {
+	direction := "ASC"
+	if o.desc != reverse {
+		direction = "DESC"
+	}
+	return o.keyExpr + " " + direction + ", " + o.idColumn + " " + direction
+}
+
+func (o keysetOrder) apply(db *gorm.DB, cursor *pageCursor) *gorm.DB {
+	if cursor == nil {
+		return db.Order(o.clause(false))
+	}
+
+	comparison := ">"
+	if o.desc != cursor.Backward {
+		comparison = "<"
+	}
+	return db.
+		Where("("+o.keyExpr+", "+o.idColumn+") "+comparison+" (?, ?)", cursor.Key, cursor.ID).
+		Order(o.clause(cursor.Backward))
+}
+
+// cursorRequest reports whether the caller asked for cursor pagination
+// (by sending a cursor parameter, empty for the first page) and decodes it.
+func cursorRequest(c *gin.Context, order keysetOrder) (*pageCursor, bool, error) {
+	value, requested := c.GetQuery("cursor")
+	if !requested {
+		return nil, false, nil
+	}
+	if value == "" {
+		return nil, true, nil
+	}
+
+	cursor, err := decodeCursor(value)
+	if err != nil {
+		return nil, true, newRequestError(http.StatusBadRequest, "Invalid cursor")
+	}
+	if cursor.Sort != order.name {
+		return nil, true, newRequestError(http.StatusBadRequest, "Cursor does not match the requested sort order")
+	}
+	if err := order.checkKey(cursor); err != nil {
+		return nil, true, newRequestError(http.StatusBadRequest, "Invalid cursor")
+	}
+	return cursor, true, nil
+}
+
+// offsetPage reads the page and limit parameters of offset pagination.
+func offsetPage(c *gin.Context, defaultLimit int) (int, int) {
+	page := 1
+	if p := c.Query("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+	return page, cursorLimit(c, defaultLimit)
+}
+
+func cursorLimit(c *gin.Context, defaultLimit int) int {
+	limit := defaultLimit
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+	return limit
+}
+
+// keysetPage trims a result fetched with limit+1 rows to the page, restores
+// display order when paging backwards, and builds the cursors either side.
+func keysetPage[T any](rows []T, limit int, cursor *pageCursor, order keysetOrder, keyOf func(T) (interface{}, string)) ([]T, gin.H) {
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+
+	backward := cursor != nil && cursor.Backward
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	hasNext := hasMore
+	hasPrev := cursor != nil
+	if backward {
+		hasNext = true
+		hasPrev = hasMore
+	}
+
+	pagination := gin.H{
+		"limit":       limit,
+		"next_cursor": nil,
+		"prev_cursor": nil,
+	}
+
+	if len(rows) > 0 {
+		if hasNext {
+			key, id := keyOf(rows[len(rows)-1])
+			pagination["next_cursor"] = encodeCursor(pageCursor{Sort: order.name, Key: key, ID: id})
+		}
+		if hasPrev {
+			key, id := keyOf(rows[0])
+			pagination["prev_cursor"] = encodeCursor(pageCursor{Sort: order.name, Key: key, ID: id, Backward: true})
+		}
+	}
+
+	return rows, pagination
+}
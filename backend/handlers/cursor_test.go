@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testRowID = "0b7e5c1e-4f0a-4d36-9a55-1f1d6d3b2a10"
+
+func TestCursorRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	createdAt := time.Date(2026, 3, 1, 12, 30, 0, 123456000, time.UTC)
+
+	tests := []struct {
+		name   string
+		order  keysetOrder
+		cursor string
+		want   int
+	}{
+		{"timestamp key", reviewOrder, encodeCursor(pageCursor{Sort: "newest", Key: createdAt, ID: testRowID}), 0},
+		{"numeric key", productSortOrders["price_asc"], encodeCursor(pageCursor{Sort: "price_asc", Key: 12.5, ID: testRowID}), 0},
+		{"integer key", productSortOrders["popularity"], encodeCursor(pageCursor{Sort: "popularity", Key: 4, ID: testRowID}), 0},
+		{"first page", reviewOrder, "", 0},
+		{"not base64", reviewOrder, "!!!", http.StatusBadRequest},
+		{"not JSON", reviewOrder, base64.RawURLEncoding.EncodeToString([]byte("nope")), http.StatusBadRequest},
+		{"missing ID", reviewOrder, encodeCursor(pageCursor{Sort: "newest", Key: createdAt}), http.StatusBadRequest},
+		{"other sort", reviewOrder, encodeCursor(pageCursor{Sort: "price_asc", Key: 12.5, ID: testRowID}), http.StatusBadRequest},
+		{"ID not a UUID", reviewOrder, encodeCursor(pageCursor{Sort: "newest", Key: createdAt, ID: "1 OR 1=1"}), http.StatusBadRequest},
+		{"string for number", productSortOrders["price_asc"], encodeCursor(pageCursor{Sort: "price_asc", Key: "12.5", ID: testRowID}), http.StatusBadRequest},
+		{"number for timestamp", reviewOrder, encodeCursor(pageCursor{Sort: "newest", Key: 1700000000, ID: testRowID}), http.StatusBadRequest},
+		{"text for timestamp", reviewOrder, encodeCursor(pageCursor{Sort: "newest", Key: "yesterday", ID: testRowID}), http.StatusBadRequest},
+		{"object key", reviewOrder, encodeCursor(pageCursor{Sort: "newest", Key: map[string]int{"a": 1}, ID: testRowID}), http.StatusBadRequest},
+		{"null key", productSortOrders["price_asc"], encodeCursor(pageCursor{Sort: "price_asc", ID: testRowID}), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/?cursor="+tt.cursor, nil)
+
+			cursor, requested, err := cursorRequest(c, tt.order)
+			if !requested {
+				t.Fatal("cursor pagination was not detected")
+			}
+			if got := errorStatus(err); got != tt.want {
+				t.Fatalf("got status %d (%v), want %d", got, err, tt.want)
+			}
+			if err == nil && tt.cursor != "" && cursor == nil {
+				t.Fatal("got no cursor")
+			}
+		})
+	}
+}
+
+func TestCursorRequestParsesTimestamps(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	createdAt := time.Date(2026, 3, 1, 12, 30, 0, 123456000, time.UTC)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/?cursor="+encodeCursor(pageCursor{Sort: "newest", Key: createdAt, ID: testRowID}), nil)
+
+	cursor, _, err := cursorRequest(c, reviewOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, ok := cursor.Key.(time.Time)
+	if !ok || !key.Equal(createdAt) {
+		t.Errorf("got key %#v, want %v", cursor.Key, createdAt)
+	}
+}
@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	reservationTTL          = 15 * time.Minute
+	reservationSweepBatch   = 100
+	reservationSweepTimeout = 30 * time.Second
+)
+
+// reservationMaxQuantity caps what one user may hold of a product or variant
+// at once, the same as the largest cart line.
+const reservationMaxQuantity = 99
+
+type InventoryHandler struct{}
+
+func NewInventoryHandler() *InventoryHandler {
+	return &InventoryHandler{}
+}
+
+func (h *InventoryHandler) CreateReservation(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var req models.ReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var reservation models.InventoryReservation
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Where("id = ?", req.ProductID).First(&product).Error; err != nil {
+			return newRequestError(http.StatusNotFound, "Product not found")
+		}
+
+		if _, err := resolveVariant(tx, &product, req.VariantID); err != nil {
+			return err
+		}
+
+		// Locking the user's holds serialises their reservations of this
+		// product, so the cap cannot be beaten by reserving in parallel.
+		var held []models.InventoryReservation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND product_id = ? AND variant_id = ? AND status = ? AND expires_at > ?", userID, product.ID, req.VariantID, models.ReservationStatusActive, time.Now()).
+			Find(&held).Error; err != nil {
+			return err
+		}
+		total := req.Quantity
+		for _, r := range held {
+			total += r.Quantity
+		}
+		if total > reservationMaxQuantity {
+			return newRequestError(http.StatusConflict, fmt.Sprintf("You can reserve at most %d units of a product", reservationMaxQuantity))
+		}
+
+		if err := decrementStock(tx, product.ID, req.VariantID, req.Quantity); err != nil {
+			return err
+		}
+
+		reservation = models.InventoryReservation{
+			ProductID: product.ID,
+			VariantID: req.VariantID,
+			UserID:    userID,
+			Quantity:  req.Quantity,
+			Status:    models.ReservationStatusActive,
+			ExpiresAt: time.Now().Add(reservationTTL),
+		}
+		return tx.Create(&reservation).Error
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to reserve stock")
+		return
+	}
+
+	c.JSON(http.StatusCreated, reservation)
+}
+
+func (h *InventoryHandler) GetReservations(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var reservations []models.InventoryReservation
+	if err := config.GetDB().
+		Where("user_id = ? AND status = ? AND expires_at > ?", userID, models.ReservationStatusActive, time.Now()).
+		Order("expires_at ASC").
+		Find(&reservations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reservations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reservations": reservations})
+}
+
+// ReleaseReservation hands a hold back early. Reservations are only ever
+// committed by checkout, against the order they pay for.
+func (h *InventoryHandler) ReleaseReservation(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var reservation models.InventoryReservation
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", c.Param("id"), userID).
+			First(&reservation).Error; err != nil {
+			return newRequestError(http.StatusNotFound, "Reservation not found")
+		}
+
+		if reservation.Status != models.ReservationStatusActive {
+			return newRequestError(http.StatusConflict, fmt.Sprintf("Reservation is already %s", reservation.Status))
+		}
+
+		return closeReservation(tx, &reservation, models.ReservationStatusReleased)
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to update reservation")
+		return
+	}
+
+	c.JSON(http.StatusOK, reservation)
+}
+
+func (h *InventoryHandler) UpdateStock(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var req models.StockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var product models.Product
+	if err := config.GetDB().Where("id = ?", c.Param("id")).First(&product).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	if product.SellerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only update your own products"})
+		return
+	}
+
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		return setStock(tx, product.ID, req.VariantID, *req.Stock)
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to update stock")
+		return
+	}
+
+	if err := config.GetDB().Preload("Variants", orderVariants).Where("id = ?", product.ID).First(&product).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		return
+	}
+	setMinPrice(&product)
+
+	c.JSON(http.StatusOK, product)
+}
+
+// decrementStock takes quantity units out of a product's (or, when variantID
+// is set, a variant's) available stock. The check and the decrement happen in
+// one conditional UPDATE, so concurrent reservations serialize on the row
+// lock and can never drive stock negative.
+func decrementStock(tx *gorm.DB, productID, variantID string, quantity int) error {
+	result := stockQuery(tx, productID, variantID).
+		Where("stock >= ?", quantity).
+		Update("stock", gorm.Expr("stock - ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return newRequestError(http.StatusConflict, "Not enough stock available")
+	}
+	return nil
+}
+
+// setStock applies a seller's stock count, which includes the units buyers
+// currently hold. Only the rest is available, so that releasing those holds
+// later brings stock back to the count rather than above it. The stock row
+// is locked first: reservations decrement it before inserting their hold, so
+// once the lock is granted every hold taken against it is visible.
+func setStock(tx *gorm.DB, productID, variantID string, count int) error {
+	var locked []int
+	if err := stockQuery(tx, productID, variantID).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Pluck("stock", &locked).Error; err != nil {
+		return err
+	}
+	if len(locked) == 0 {
+		if variantID != "" {
+			return newRequestError(http.StatusNotFound, "Variant not found")
+		}
+		return newRequestError(http.StatusNotFound, "Product not found")
+	}
+
+	var held int
+	if err := tx.Model(&models.InventoryReservation{}).
+		Where("product_id = ? AND variant_id = ? AND status = ?", productID, variantID, models.ReservationStatusActive).
+		Select("COALESCE(SUM(quantity), 0)").
+		Scan(&held).Error; err != nil {
+		return err
+	}
+	if count < held {
+		return newRequestError(http.StatusConflict, fmt.Sprintf("Stock cannot be lower than the %d units currently reserved", held))
+	}
+
+	return stockQuery(tx, productID, variantID).Update("stock", count-held).Error
+}
+
+func restoreStock(tx *gorm.DB, productID, variantID string, quantity int) error {
+	return stockQuery(tx, productID, variantID).
+		Update("stock", gorm.Expr("stock + ?", quantity)).Error
+}
+
+func stockQuery(tx *gorm.DB, productID, variantID string) *gorm.DB {
+	if variantID != "" {
+		return tx.Model(&models.ProductVariant{}).Where("id = ? AND product_id = ?", variantID, productID)
+	}
+	return tx.Model(&models.Product{}).Where("id = ?", productID)
+}
+
+// closeReservation moves an active reservation to its final status. Anything
+// other than a commit hands the held units back to the product.
+func closeReservation(tx *gorm.DB, reservation *models.InventoryReservation, status string) error {
+	if status != models.ReservationStatusCommitted {
+		if err := restoreStock(tx, reservation.ProductID, reservation.VariantID, reservation.Quantity); err != nil {
+			return err
+		}
+	}
+
+	reservation.Status = status
+	return tx.Model(reservation).Update("status", status).Error
+}
+
+// reserveForOrder holds stock for one checkout line, reusing the buyer's own
+// active reservations for the product before taking fresh units, and commits
+// everything against the order.
+func reserveForOrder(tx *gorm.DB, order *models.Order, productID, variantID string, quantity int) error {
+	var held []models.InventoryReservation
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND product_id = ? AND variant_id = ? AND status = ? AND expires_at > ?", order.BuyerID, productID, variantID, models.ReservationStatusActive, time.Now()).
+		Order("created_at ASC").
+		Find(&held).Error; err != nil {
+		return err
+	}
+
+	remaining := quantity
+	split := 0
+	for i := range held {
+		if remaining == 0 {
+			break
+		}
+		// A hold larger than what is left is split: the order takes what it
+		// needs and the rest stays held for the buyer.
+		if held[i].Quantity > remaining {
+			if err := tx.Model(&held[i]).Update("quantity", held[i].Quantity-remaining).Error; err != nil {
+				return err
+			}
+			split, remaining = remaining, 0
+			break
+		}
+		if err := tx.Model(&held[i]).Updates(map[string]interface{}{
+			"status":   models.ReservationStatusCommitted,
+			"order_id": order.ID,
+		}).Error; err != nil {
+			return err
+		}
+		remaining -= held[i].Quantity
+	}
+
+	if remaining > 0 {
+		if err := decrementStock(tx, productID, variantID, remaining); err != nil {
+			var reqErr *requestError
+			if errors.As(err, &reqErr) {
+				return newRequestError(http.StatusConflict, fmt.Sprintf("Not enough stock available for product %s", productID))
+			}
+			return err
+		}
+	}
+
+	if split+remaining == 0 {
+		return nil
+	}
+	reservation := models.InventoryReservation{
+		ProductID: productID,
+		VariantID: variantID,
+		UserID:    order.BuyerID,
+		OrderID:   &order.ID,
+		Quantity:  split + remaining,
+		Status:    models.ReservationStatusCommitted,
+		ExpiresAt: time.Now(),
+	}
+	return tx.Create(&reservation).Error
+}
+
+// restockOrder returns the units committed to an order, used when an order
+// is cancelled before it ships.
+func restockOrder(tx *gorm.DB, orderID string) error {
+	var committed []models.InventoryReservation
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND status = ?", orderID, models.ReservationStatusCommitted).
+		Find(&committed).Error; err != nil {
+		return err
+	}
+
+	for i := range committed {
+		if err := closeReservation(tx, &committed[i], models.ReservationStatusReleased); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunReservationSweeper releases expired reservations every interval until
+// ctx is cancelled. Rows are claimed with SKIP LOCKED so several instances
+// can sweep at once without double-restoring stock.
+func RunReservationSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			released, err := releaseExpiredReservations(ctx)
+			if err != nil {
+				log.Printf("Reservation sweep failed: %v", err)
+				continue
+			}
+			if released > 0 {
+				log.Printf("Released %d expired reservations", released)
+			}
+		}
+	}
+}
+
+func releaseExpiredReservations(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		sweepCtx, cancel := context.WithTimeout(ctx, reservationSweepTimeout)
+		released := 0
+		err := config.GetDB().WithContext(sweepCtx).Transaction(func(tx *gorm.DB) error {
+			var expired []models.InventoryReservation
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("status = ? AND expires_at <= ?", models.ReservationStatusActive, time.Now()).
+				Limit(reservationSweepBatch).
+				Find(&expired).Error; err != nil {
+				return err
+			}
+
+			for i := range expired {
+				if err := closeReservation(tx, &expired[i], models.ReservationStatusExpired); err != nil {
+					return err
+				}
+			}
+			released = len(expired)
+			return nil
+		})
+		cancel()
+		if err != nil {
+			return total, err
+		}
+
+		total += released
+		if released < reservationSweepBatch {
+			return total, nil
+		}
+	}
+}
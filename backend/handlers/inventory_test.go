@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB builds statements without a database. Every statement reports no
+// affected rows, and the SQL of each is passed to record.
+func dryRunDB(t *testing.T, record func(sql string, vars []interface{})) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("test:record", func(tx *gorm.DB) {
+		record(tx.Statement.SQL.String(), tx.Statement.Vars)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestDecrementStock(t *testing.T) {
+	tests := []struct {
+		name      string
+		variantID string
+		table     string
+		wantVars  []interface{}
+	}{
+		{"product", "", `UPDATE "products"`, []interface{}{3, "product-1", 3}},
+		{"variant", "variant-1", `UPDATE "product_variants"`, []interface{}{3, "variant-1", "product-1", 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sql string
+			var vars []interface{}
+			db := dryRunDB(t, func(s string, v []interface{}) { sql, vars = s, v })
+
+			err := decrementStock(db, "product-1", tt.variantID, 3)
+
+			// A dry run touches no rows, which is what running out of stock
+			// looks like.
+			if got := errorStatus(err); got != http.StatusConflict {
+				t.Errorf("got status %d, want %d", got, http.StatusConflict)
+			}
+			if !strings.HasPrefix(sql, tt.table) {
+				t.Errorf("got %q, want an update of %s", sql, tt.table)
+			}
+			// The check and the decrement must be one conditional statement.
+			for _, part := range []string{`"stock"=stock - $1`, "stock >= $"} {
+				if !strings.Contains(sql, part) {
+					t.Errorf("got %q, want it to contain %q", sql, part)
+				}
+			}
+			// updated_at is set to the current time as well.
+			var got []interface{}
+			for _, v := range vars {
+				if _, ok := v.(time.Time); !ok {
+					got = append(got, v)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantVars) {
+				t.Errorf("got vars %v, want %v", got, tt.wantVars)
+			}
+		})
+	}
+}
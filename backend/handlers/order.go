@@ -0,0 +1,445 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	orderActorBuyer  = "buyer"
+	orderActorSeller = "seller"
+	orderActorSystem = "system"
+)
+
+// orderTransitions lists, for every status, the statuses it may move to and
+// which actors may perform that move. Delivered, cancelled and refunded
+// orders are terminal unless listed here. Once money has been captured only
+// the system moves an order to refunded, after the payment provider has
+// returned it, so a paid order cannot be cancelled or marked refunded by hand.
+var orderTransitions = map[string]map[string][]string{
+	models.OrderStatusPending: {
+		models.OrderStatusPaid:      {orderActorSystem},
+		models.OrderStatusCancelled: {orderActorBuyer, orderActorSeller, orderActorSystem},
+	},
+	models.OrderStatusPaid: {
+		models.OrderStatusShipped:  {orderActorSeller},
+		models.OrderStatusRefunded: {orderActorSystem},
+	},
+	models.OrderStatusShipped: {
+		models.OrderStatusDelivered: {orderActorBuyer, orderActorSeller},
+		models.OrderStatusRefunded:  {orderActorSystem},
+	},
+	models.OrderStatusDelivered: {
+		models.OrderStatusRefunded: {orderActorSystem},
+	},
+}
+
+type OrderHandler struct{}
+
+func NewOrderHandler() *OrderHandler {
+	return &OrderHandler{}
+}
+
+type checkoutLine struct {
+	product  models.Product
+	variant  *models.ProductVariant
+	quantity int
+}
+
+func (h *OrderHandler) Checkout(c *gin.Context) {
+	userID, username, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var req models.CheckoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	checkoutID := uuid.New().String()
+	var orders []models.Order
+
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		lines, cart, err := resolveCheckoutLines(tx, userID, req)
+		if err != nil {
+			return err
+		}
+
+		bySeller := make(map[string]*models.Order)
+		var sellerOrder []string
+		for _, line := range lines {
+			order, exists := bySeller[line.product.SellerID]
+			if !exists {
+				order = &models.Order{
+					CheckoutID: checkoutID,
+					BuyerID:    userID,
+					BuyerName:  username,
+					SellerID:   line.product.SellerID,
+					SellerName: line.product.SellerName,
+					Status:     models.OrderStatusPending,
+				}
+				bySeller[line.product.SellerID] = order
+				sellerOrder = append(sellerOrder, line.product.SellerID)
+			}
+
+			price := unitPrice(&line.product, line.variant)
+			lineTotal := roundPrice(price * float64(line.quantity))
+			item := models.OrderItem{
+				ProductID:   line.product.ID,
+				ProductName: line.product.Name,
+				SellerID:    line.product.SellerID,
+				UnitPrice:   price,
+				Quantity:    line.quantity,
+				LineTotal:   lineTotal,
+			}
+			if line.variant != nil {
+				item.VariantID = line.variant.ID
+				item.VariantName = line.variant.Name
+				item.SKU = line.variant.SKU
+			}
+			order.Items = append(order.Items, item)
+			order.Total = roundPrice(order.Total + lineTotal)
+		}
+
+		for _, sellerID := range sellerOrder {
+			order := bySeller[sellerID]
+			if err := tx.Create(order).Error; err != nil {
+				return err
+			}
+
+			for _, item := range order.Items {
+				if err := reserveForOrder(tx, order, item.ProductID, item.VariantID, item.Quantity); err != nil {
+					return err
+				}
+			}
+
+			history := models.OrderStatusHistory{
+				OrderID:   order.ID,
+				ToStatus:  models.OrderStatusPending,
+				ChangedBy: userID,
+				Note:      "Order placed",
+			}
+			if err := tx.Create(&history).Error; err != nil {
+				return err
+			}
+
+			orders = append(orders, *order)
+		}
+
+		if cart != nil {
+			if err := tx.Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to place order")
+		return
+	}
+
+	var total float64
+	for _, order := range orders {
+		total += order.Total
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"checkoutId": checkoutID,
+		"orders":     orders,
+		"total":      roundPrice(total),
+	})
+}
+
+// resolveCheckoutLines turns the request into priced lines. An empty item
+// list means "check out my cart"; in that case the cart is returned so the
+// caller can empty it once the orders are written.
+func resolveCheckoutLines(tx *gorm.DB, userID string, req models.CheckoutRequest) ([]checkoutLine, *models.Cart, error) {
+	var cart *models.Cart
+	requested := req.Items
+	addedPrices := make(map[string]float64)
+
+	if len(requested) == 0 {
+		var err error
+		cart, err = findOrCreateCart(tx, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var items []models.CartItem
+		if err := tx.Where("cart_id = ?", cart.ID).Order("created_at ASC").Find(&items).Error; err != nil {
+			return nil, nil, err
+		}
+		if len(items) == 0 {
+			return nil, nil, newRequestError(http.StatusBadRequest, "Cart is empty")
+		}
+
+		for _, item := range items {
+			requested = append(requested, models.CartItemRequest{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity})
+			addedPrices[item.ProductID+":"+item.VariantID] = item.UnitPrice
+		}
+	}
+
+	quantities := make(map[string]int)
+	var keys []string
+	var productIDs []string
+	seenProducts := make(map[string]bool)
+	for _, item := range requested {
+		key := item.ProductID + ":" + item.VariantID
+		if _, seen := quantities[key]; !seen {
+			keys = append(keys, key)
+		}
+		quantities[key] += item.Quantity
+
+		if !seenProducts[item.ProductID] {
+			seenProducts[item.ProductID] = true
+			productIDs = append(productIDs, item.ProductID)
+		}
+	}
+
+	var products []models.Product
+	if err := tx.Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+		return nil, nil, err
+	}
+
+	byID := make(map[string]models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+
+	lines := make([]checkoutLine, 0, len(keys))
+	for _, key := range keys {
+		productID, variantID, _ := strings.Cut(key, ":")
+
+		product, exists := byID[productID]
+		if !exists {
+			return nil, nil, newRequestError(http.StatusConflict, fmt.Sprintf("Product %s is no longer available", productID))
+		}
+
+		if product.SellerID == userID {
+			return nil, nil, newRequestError(http.StatusBadRequest, "You cannot purchase your own product")
+		}
+
+		variant, err := resolveVariant(tx, &product, variantID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if addedPrice, fromCart := addedPrices[key]; fromCart && addedPrice != unitPrice(&product, variant) && !req.AcceptPriceChanges {
+			return nil, nil, newRequestError(http.StatusConflict, "Prices in your cart have changed, please review your cart")
+		}
+
+		lines = append(lines, checkoutLine{product: product, variant: variant, quantity: quantities[key]})
+	}
+
+	return lines, cart, nil
+}
+
+func (h *OrderHandler) GetOrders(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	h.listOrders(c, config.GetDB().Where("buyer_id = ?", userID))
+}
+
+func (h *OrderHandler) GetSellerOrders(c *gin.Context) {
+	userID, _, role, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	if role != "seller" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only sellers can access this endpoint"})
+		return
+	}
+
+	h.listOrders(c, config.GetDB().Where("seller_id = ?", userID))
+}
+
+func (h *OrderHandler) listOrders(c *gin.Context, query *gorm.DB) {
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	page := 1
+	limit := 20
+	if p := c.Query("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+
+	offset := (page - 1) * limit
+
+	var total int64
+	query.Model(&models.Order{}).Count(&total)
+
+	var orders []models.Order
+	if err := query.Preload("Items").Offset(offset).Limit(limit).Order("created_at DESC").Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders": orders,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+func (h *OrderHandler) GetOrder(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var order models.Order
+	if err := config.GetDB().
+		Preload("Items").
+		Preload("History", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC, id ASC") }).
+		Where("id = ?", c.Param("id")).
+		First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	if order.BuyerID != userID && order.SellerID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var req models.OrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var order models.Order
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", c.Param("id")).First(&order).Error; err != nil {
+			return newRequestError(http.StatusNotFound, "Order not found")
+		}
+
+		var actor string
+		switch userID {
+		case order.BuyerID:
+			actor = orderActorBuyer
+		case order.SellerID:
+			actor = orderActorSeller
+		default:
+			return newRequestError(http.StatusNotFound, "Order not found")
+		}
+
+		return transitionOrder(tx, &order, req.Status, actor, userID, req.Note)
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to update order status")
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// checkOrderTransition reports whether actor may move an order from one
+// status to another.
+func checkOrderTransition(from, to, actor string) error {
+	allowedActors, valid := orderTransitions[from][to]
+	if !valid {
+		return newRequestError(http.StatusConflict, fmt.Sprintf("Cannot change order status from %s to %s", from, to))
+	}
+
+	for _, allowed := range allowedActors {
+		if allowed == actor {
+			return nil
+		}
+	}
+	return newRequestError(http.StatusForbidden, fmt.Sprintf("You are not allowed to mark this order as %s", to))
+}
+
+// transitionOrder moves an order to a new status if the state machine and the
+// actor allow it, recording a history row in the same transaction. The
+// update is conditional on the current status so concurrent transitions
+// cannot both succeed.
+func transitionOrder(tx *gorm.DB, order *models.Order, to, actor, changedBy, note string) error {
+	if err := checkOrderTransition(order.Status, to, actor); err != nil {
+		return err
+	}
+
+	result := tx.Model(&models.Order{}).
+		Where("id = ? AND status = ?", order.ID, order.Status).
+		Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return newRequestError(http.StatusConflict, "Order status was changed by another request")
+	}
+
+	history := models.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   to,
+		ChangedBy:  changedBy,
+		Note:       note,
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return err
+	}
+
+	switch to {
+	case models.OrderStatusCancelled:
+		if err := restockOrder(tx, order.ID); err != nil {
+			return err
+		}
+	case models.OrderStatusShipped:
+		if err := recordPurchases(tx, order); err != nil {
+			return err
+		}
+	case models.OrderStatusRefunded:
+		if err := revokePurchases(tx, order); err != nil {
+			return err
+		}
+	}
+
+	order.Status = to
+	return nil
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"shopsphere-backend/models"
+)
+
+// errorStatus is the HTTP status a handler would answer err with, or 0 for
+// no error.
+func errorStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.status
+	}
+	return http.StatusInternalServerError
+}
+
+func TestCheckOrderTransition(t *testing.T) {
+	tests := []struct {
+		from, to, actor string
+		want            int
+	}{
+		{models.OrderStatusPending, models.OrderStatusPaid, orderActorSystem, 0},
+		{models.OrderStatusPending, models.OrderStatusPaid, orderActorSeller, http.StatusForbidden},
+		{models.OrderStatusPending, models.OrderStatusPaid, orderActorBuyer, http.StatusForbidden},
+		{models.OrderStatusPending, models.OrderStatusCancelled, orderActorBuyer, 0},
+		{models.OrderStatusPending, models.OrderStatusCancelled, orderActorSeller, 0},
+		{models.OrderStatusPending, models.OrderStatusShipped, orderActorSeller, http.StatusConflict},
+		{models.OrderStatusPaid, models.OrderStatusShipped, orderActorSeller, 0},
+		{models.OrderStatusPaid, models.OrderStatusShipped, orderActorBuyer, http.StatusForbidden},
+		{models.OrderStatusPaid, models.OrderStatusCancelled, orderActorBuyer, http.StatusConflict},
+		{models.OrderStatusPaid, models.OrderStatusCancelled, orderActorSeller, http.StatusConflict},
+		{models.OrderStatusPaid, models.OrderStatusRefunded, orderActorSystem, 0},
+		{models.OrderStatusPaid, models.OrderStatusRefunded, orderActorSeller, http.StatusForbidden},
+		{models.OrderStatusShipped, models.OrderStatusRefunded, orderActorSeller, http.StatusForbidden},
+		{models.OrderStatusShipped, models.OrderStatusRefunded, orderActorSystem, 0},
+		{models.OrderStatusShipped, models.OrderStatusDelivered, orderActorBuyer, 0},
+		{models.OrderStatusShipped, models.OrderStatusCancelled, orderActorSeller, http.StatusConflict},
+		{models.OrderStatusDelivered, models.OrderStatusRefunded, orderActorSeller, http.StatusForbidden},
+		{models.OrderStatusDelivered, models.OrderStatusRefunded, orderActorSystem, 0},
+		{models.OrderStatusDelivered, models.OrderStatusShipped, orderActorSeller, http.StatusConflict},
+		{models.OrderStatusCancelled, models.OrderStatusPending, orderActorSeller, http.StatusConflict},
+		{models.OrderStatusRefunded, models.OrderStatusPaid, orderActorSystem, http.StatusConflict},
+		{models.OrderStatusPaid, models.OrderStatusPaid, orderActorSystem, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		got := errorStatus(checkOrderTransition(tt.from, tt.to, tt.actor))
+		if got != tt.want {
+			t.Errorf("%s -> %s by %s: got status %d, want %d", tt.from, tt.to, tt.actor, got, tt.want)
+		}
+	}
+}
+
+func TestOrderTransitionsAreKnownStatuses(t *testing.T) {
+	known := map[string]bool{
+		models.OrderStatusPending:   true,
+		models.OrderStatusPaid:      true,
+		models.OrderStatusShipped:   true,
+		models.OrderStatusDelivered: true,
+		models.OrderStatusCancelled: true,
+		models.OrderStatusRefunded:  true,
+	}
+	actors := map[string]bool{orderActorBuyer: true, orderActorSeller: true, orderActorSystem: true}
+
+	for from, targets := range orderTransitions {
+		if !known[from] {
+			t.Errorf("unknown status %q", from)
+		}
+		for to, allowed := range targets {
+			if !known[to] {
+				t.Errorf("%s: unknown target status %q", from, to)
+			}
+			if len(allowed) == 0 {
+				t.Errorf("%s -> %s: nobody may make this move", from, to)
+			}
+			for _, actor := range allowed {
+				if !actors[actor] {
+					t.Errorf("%s -> %s: unknown actor %q", from, to, actor)
+				}
+			}
+		}
+	}
+}
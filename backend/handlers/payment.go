@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+	"shopsphere-backend/payments"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const paymentSignatureHeader = "X-Payment-Signature"
+
+// activePaymentPredicate matches the WHERE clause of idx_payments_active_order.
+const activePaymentPredicate = "status <> 'refunded' AND status <> 'failed'"
+
+// paymentPendingTimeout is how long a payment may wait for the provider to
+// authorize it. A pending payment older than this (say the server stopped
+// mid-request) is marked failed when the buyer tries again, so it no longer
+// blocks the order.
+const paymentPendingTimeout = 15 * time.Minute
+
+type PaymentHandler struct {
+	provider payments.PaymentProvider
+}
+
+func NewPaymentHandler(provider payments.PaymentProvider) *PaymentHandler {
+	return &PaymentHandler{provider: provider}
+}
+
+func (h *PaymentHandler) AuthorizePayment(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var order models.Order
+	if err := config.GetDB().Where("id = ? AND buyer_id = ?", c.Param("id"), userID).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	if order.Status != models.OrderStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending orders can be paid"})
+		return
+	}
+
+	if err := config.GetDB().Model(&models.Payment{}).
+		Where("order_id = ? AND status = ? AND created_at < ?", order.ID, models.PaymentStatusPending, time.Now().Add(-paymentPendingTimeout)).
+		Updates(map[string]interface{}{"status": models.PaymentStatusFailed, "failure_reason": "Authorization timed out"}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
+		return
+	}
+
+	payment := models.Payment{
+		OrderID:  order.ID,
+		BuyerID:  order.BuyerID,
+		SellerID: order.SellerID,
+		Amount:   order.Total,
+		Provider: h.provider.Name(),
+		Status:   models.PaymentStatusPending,
+	}
+	// idx_payments_active_order allows one active payment per order, so of
+	// two concurrent attempts only one gets to the provider.
+	created := config.GetDB().Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "order_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: activePaymentPredicate}}},
+		DoNothing:   true,
+	}).Create(&payment)
+	if created.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
+		return
+	}
+	if created.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order already has an active payment"})
+		return
+	}
+
+	result, err := h.provider.Authorize(c.Request.Context(), payments.AuthorizeRequest{
+		PaymentID: payment.ID,
+		OrderID:   order.ID,
+		BuyerID:   order.BuyerID,
+		SellerID:  order.SellerID,
+		Amount:    payments.ToMinorUnits(payment.Amount),
+		Currency:  payment.Currency,
+	})
+	if err != nil {
+		payment.Status = models.PaymentStatusFailed
+		payment.FailureReason = err.Error()
+		if saveErr := config.GetDB().Model(&models.Payment{}).
+			Where("id = ? AND status = ?", payment.ID, models.PaymentStatusPending).
+			Updates(map[string]interface{}{"status": payment.Status, "failure_reason": payment.FailureReason}).Error; saveErr != nil {
+			log.Printf("Failed to record failed payment %s: %v", payment.ID, saveErr)
+		}
+
+		if errors.Is(err, payments.ErrDeclined) {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Payment declined", "payment": payment})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Payment provider error"})
+		return
+	}
+
+	payment.ProviderRef = result.ProviderRef
+	payment.Status = models.PaymentStatusAuthorized
+	authorized := config.GetDB().Model(&models.Payment{}).
+		Where("id = ? AND status = ?", payment.ID, models.PaymentStatusPending).
+		Updates(map[string]interface{}{"provider_ref": payment.ProviderRef, "status": payment.Status})
+	if authorized.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment"})
+		return
+	}
+	if authorized.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment was changed by another request"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, payment)
+}
+
+func (h *PaymentHandler) CapturePayment(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	// The payment stays locked while the provider is called, so a second
+	// capture or a webhook waits and then sees the captured payment.
+	var payment models.Payment
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND seller_id = ?", c.Param("id"), userID).
+			First(&payment).Error; err != nil {
+			return newRequestError(http.StatusNotFound, "Payment not found")
+		}
+
+		if payment.Status != models.PaymentStatusAuthorized {
+			return newRequestError(http.StatusConflict, "Only authorized payments can be captured")
+		}
+
+		var order models.Order
+		if err := tx.Where("id = ?", payment.OrderID).First(&order).Error; err != nil {
+			return newRequestError(http.StatusNotFound, "Order not found")
+		}
+
+		if order.Status != models.OrderStatusPending {
+			return newRequestError(http.StatusConflict, "Order is no longer awaiting payment")
+		}
+
+		result, err := h.provider.Capture(c.Request.Context(), payment.ProviderRef, payments.ToMinorUnits(payment.Amount))
+		if err != nil {
+			log.Printf("Payment capture failed for %s: %v", payment.ID, err)
+			return newRequestError(http.StatusBadGateway, "Payment provider error")
+		}
+
+		return applyPaymentCapture(tx, &payment, result.Amount)
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to record payment capture")
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+func (h *PaymentHandler) RefundPayment(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var req models.RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// As with capture, the lock is held across the provider call, so the
+	// remaining amount is checked and reduced by one refund at a time.
+	var payment models.Payment
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND seller_id = ?", c.Param("id"), userID).
+			First(&payment).Error; err != nil {
+			return newRequestError(http.StatusNotFound, "Payment not found")
+		}
+
+		if payment.Status != models.PaymentStatusCaptured {
+			return newRequestError(http.StatusConflict, "Only captured payments can be refunded")
+		}
+
+		remaining := payments.ToMinorUnits(payment.CapturedAmount) - payments.ToMinorUnits(payment.RefundedAmount)
+		amount := remaining
+		if req.Amount > 0 {
+			amount = payments.ToMinorUnits(req.Amount)
+		}
+		if amount > remaining {
+			return newRequestError(http.StatusBadRequest, "Refund exceeds the captured amount")
+		}
+
+		result, err := h.provider.Refund(c.Request.Context(), payment.ProviderRef, amount)
+		if err != nil {
+			log.Printf("Payment refund failed for %s: %v", payment.ID, err)
+			return newRequestError(http.StatusBadGateway, "Payment provider error")
+		}
+
+		return applyPaymentRefund(tx, &payment, result.Amount)
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to record payment refund")
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+func (h *PaymentHandler) GetPayment(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var payment models.Payment
+	if err := config.GetDB().
+		Where("id = ? AND (buyer_id = ? OR seller_id = ?)", c.Param("id"), userID, userID).
+		First(&payment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+func (h *PaymentHandler) GetOrderPayments(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var paymentList []models.Payment
+	if err := config.GetDB().
+		Where("order_id = ? AND (buyer_id = ? OR seller_id = ?)", c.Param("id"), userID, userID).
+		Order("created_at DESC").
+		Find(&paymentList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payments": paymentList})
+}
+
+// HandleWebhook accepts provider callbacks. Events are applied at most once,
+// keyed by the provider's event ID, and only move payments forward.
+func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read webhook payload"})
+		return
+	}
+
+	event, err := h.provider.VerifyWebhook(payload, c.GetHeader(paymentSignatureHeader))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook signature"})
+		return
+	}
+
+	if event.ID == "" || event.ProviderRef == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook event is missing required fields"})
+		return
+	}
+
+	err = config.GetDB().Transaction(func(tx *gorm.DB) error {
+		record := models.PaymentWebhookEvent{
+			ID:       event.ID,
+			Provider: h.provider.Name(),
+			Type:     event.Type,
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		var payment models.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("provider = ? AND provider_ref = ?", h.provider.Name(), event.ProviderRef).
+			First(&payment).Error; err != nil {
+			return newRequestError(http.StatusNotFound, "Payment not found")
+		}
+
+		if err := tx.Model(&record).Update("payment_id", payment.ID).Error; err != nil {
+			return err
+		}
+
+		switch event.Type {
+		case payments.EventPaymentAuthorized:
+			if payment.Status != models.PaymentStatusPending {
+				return nil
+			}
+			payment.Status = models.PaymentStatusAuthorized
+			return tx.Save(&payment).Error
+		case payments.EventPaymentCaptured:
+			if payment.Status != models.PaymentStatusAuthorized {
+				return nil
+			}
+			return applyPaymentCapture(tx, &payment, event.Amount)
+		case payments.EventPaymentRefunded:
+			if payment.Status != models.PaymentStatusCaptured {
+				return nil
+			}
+			return applyPaymentRefund(tx, &payment, event.Amount)
+		case payments.EventPaymentFailed:
+			if payment.Status != models.PaymentStatusPending && payment.Status != models.PaymentStatusAuthorized {
+				return nil
+			}
+			payment.Status = models.PaymentStatusFailed
+			payment.FailureReason = event.Reason
+			return tx.Save(&payment).Error
+		default:
+			log.Printf("Ignoring unknown payment webhook event type %q", event.Type)
+			return nil
+		}
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to process webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// applyPaymentCapture and applyPaymentRefund expect the caller to hold the
+// payment's row lock. Their updates are still conditional on the status read
+// under that lock, and the refunded amount is added in SQL.
+func applyPaymentCapture(tx *gorm.DB, payment *models.Payment, amount int64) error {
+	payment.Status = models.PaymentStatusCaptured
+	payment.CapturedAmount = payments.FromMinorUnits(amount)
+	result := tx.Model(&models.Payment{}).
+		Where("id = ? AND status = ?", payment.ID, models.PaymentStatusAuthorized).
+		Updates(map[string]interface{}{"status": payment.Status, "captured_amount": payment.CapturedAmount})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return newRequestError(http.StatusConflict, "Payment was changed by another request")
+	}
+
+	var order models.Order
+	if err := tx.Where("id = ?", payment.OrderID).First(&order).Error; err != nil {
+		return err
+	}
+
+	if order.Status != models.OrderStatusPending {
+		return nil
+	}
+	return transitionOrder(tx, &order, models.OrderStatusPaid, orderActorSystem, "", "Payment captured")
+}
+
+func applyPaymentRefund(tx *gorm.DB, payment *models.Payment, amount int64) error {
+	refunded := payments.ToMinorUnits(payment.RefundedAmount) + amount
+	fullyRefunded := refunded >= payments.ToMinorUnits(payment.CapturedAmount)
+	status := models.PaymentStatusCaptured
+	if fullyRefunded {
+		status = models.PaymentStatusRefunded
+	}
+
+	result := tx.Model(&models.Payment{}).
+		Where("id = ? AND status = ?", payment.ID, models.PaymentStatusCaptured).
+		Updates(map[string]interface{}{
+			"refunded_amount": gorm.Expr("refunded_amount + ?", payments.FromMinorUnits(amount)),
+			"status":          status,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return newRequestError(http.StatusConflict, "Payment was changed by another request")
+	}
+	payment.RefundedAmount = payments.FromMinorUnits(refunded)
+	payment.Status = status
+
+	if !fullyRefunded {
+		return nil
+	}
+
+	var order models.Order
+	if err := tx.Where("id = ?", payment.OrderID).First(&order).Error; err != nil {
+		return err
+	}
+
+	if _, allowed := orderTransitions[order.Status][models.OrderStatusRefunded]; !allowed {
+		return nil
+	}
+	return transitionOrder(tx, &order, models.OrderStatusRefunded, orderActorSystem, "", "Payment refunded")
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -8,30 +9,34 @@ import (
 	"shopsphere-backend/config"
 	"shopsphere-backend/middleware"
 	"shopsphere-backend/models"
+	"shopsphere-backend/storage"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-type ProductHandler struct{}
+type ProductHandler struct {
+	blobs storage.BlobStore
+}
 
-func NewProductHandler() *ProductHandler {
-	return &ProductHandler{}
+func NewProductHandler(blobs storage.BlobStore) *ProductHandler {
+	return &ProductHandler{blobs: blobs}
 }
 
 func (h *ProductHandler) GetProducts(c *gin.Context) {
 	var products []models.Product
-	query := config.GetDB()
-
-	if category := c.Query("category"); category != "" {
-		query = query.Where("category = ?", category)
-	}
+	listing := parseProductListing(c)
 
-	if sellerID := c.Query("seller_id"); sellerID != "" {
-		query = query.Where("seller_id = ?", sellerID)
+	cursor, cursorMode, err := cursorRequest(c, listing.order)
+	if err != nil {
+		respondWithError(c, err, "Failed to fetch products")
+		return
 	}
 
-	if search := c.Query("search"); search != "" {
-		query = query.Where("name ILIKE ?", "%"+search+"%")
+	if cursorMode {
+		h.getProductsByCursor(c, listing, cursor)
+		return
 	}
 
 	page := 1
@@ -50,15 +55,29 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 	offset := (page - 1) * limit
 
 	var total int64
-	query.Model(&models.Product{}).Count(&total)
-
-	if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&products).Error; err != nil {
+	listing.query(config.GetDB(), "").Model(&models.Product{}).Count(&total)
+
+	if err := listing.query(config.GetDB(), "").
+		Select(listing.columns()).
+		Offset(offset).
+		Limit(limit).
+		Order(listing.order.clause(false)).
+		Find(&products).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 		return
 	}
 
+	listing.renderHeadlines(products)
+
+	facets, err := productFacets(config.GetDB(), listing)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product facets"})
+		return
+	}
+
 	response := gin.H{
 		"products": products,
+		"facets":   facets,
 		"pagination": gin.H{
 			"page":        page,
 			"limit":       limit,
@@ -70,6 +89,34 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+func (h *ProductHandler) getProductsByCursor(c *gin.Context, listing productListing, cursor *pageCursor) {
+	limit := cursorLimit(c, 20)
+
+	var products []models.Product
+	query := listing.query(config.GetDB(), "").Select(listing.columns())
+	if err := listing.order.apply(query, cursor).Limit(limit + 1).Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+
+	products, pagination := keysetPage(products, limit, cursor, listing.order, func(product models.Product) (interface{}, string) {
+		return productSortKey(listing.order, product), product.ID
+	})
+	listing.renderHeadlines(products)
+
+	facets, err := productFacets(config.GetDB(), listing)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product facets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"products":   products,
+		"facets":     facets,
+		"pagination": pagination,
+	})
+}
+
 func (h *ProductHandler) GetProduct(c *gin.Context) {
 	productID := c.Param("id")
 	p, hasSeller := extractSecondUUID(productID)
@@ -77,10 +124,19 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 		productID = p
 	}
 	var product models.Product
-	if err := config.GetDB().Where("id = ?", productID).First(&product).Error; err != nil {
+	if err := config.GetDB().Preload("Variants", orderVariants).Where("id = ?", productID).First(&product).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
+	setMinPrice(&product)
+
+	totals, err := productRatingTotals(config.GetDB(), product.ID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product rating"})
+		return
+	}
+	product.AverageRating = totals.Average()
+	product.ReviewCount = totals.RatingCount
 
 	c.JSON(http.StatusOK, product)
 }
@@ -120,11 +176,21 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		SellerName:  username,
 		Category:    req.Category,
 	}
+	if req.Stock != nil {
+		product.Stock = *req.Stock
+	}
 
-	if err := config.GetDB().Create(&product).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Variants").Create(&product).Error; err != nil {
+			return err
+		}
+		return syncProductVariants(tx, &product, req.Variants)
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to create product")
 		return
 	}
+	setMinPrice(&product)
 
 	c.JSON(http.StatusCreated, product)
 }
@@ -160,17 +226,48 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	product.Name = req.Name
-	product.Description = req.Description
-	product.Price = req.Price
-	product.ImageURL = req.ImageURL
-	product.Category = req.Category
-	product.SellerName = username
+	// Only the edited columns are written: stock moves with every reservation,
+	// so saving the row read above could put back units already sold. A new
+	// stock count goes through setStock, which allows for current holds.
+	updates := map[string]interface{}{
+		"name":        req.Name,
+		"description": req.Description,
+		"price":       req.Price,
+		"image_url":   req.ImageURL,
+		"category":    req.Category,
+		"seller_name": username,
+	}
+
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&product).Updates(updates).Error; err != nil {
+			return err
+		}
+		if req.Stock != nil {
+			if err := setStock(tx, product.ID, "", *req.Stock); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("id = ?", product.ID).First(&product).Error; err != nil {
+			return err
+		}
+		if req.Variants == nil {
+			return tx.Where("product_id = ?", product.ID).Order("created_at ASC").Find(&product.Variants).Error
+		}
+		return syncProductVariants(tx, &product, req.Variants)
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to update product")
+		return
+	}
+	setMinPrice(&product)
 
-	if err := config.GetDB().Save(&product).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+	totals, err := productRatingTotals(config.GetDB(), product.ID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product rating"})
 		return
 	}
+	product.AverageRating = totals.Average()
+	product.ReviewCount = totals.RatingCount
 
 	c.JSON(http.StatusOK, product)
 }
@@ -200,15 +297,47 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	if err := config.GetDB().Where("product_id = ?", productID).Delete(&models.Review{}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete associated reviews"})
-		return
-	}
+	var photos []models.ReviewPhoto
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Locking the holds waits out a checkout that is committing them.
+		var held []models.InventoryReservation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("product_id = ? AND status = ?", product.ID, models.ReservationStatusActive).
+			Find(&held).Error; err != nil {
+			return err
+		}
+		for i := range held {
+			if err := closeReservation(tx, &held[i], models.ReservationStatusReleased); err != nil {
+				return err
+			}
+		}
 
-	if err := config.GetDB().Delete(&product).Error; err != nil {
+		var reviews []models.Review
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id = ?", product.ID).Find(&reviews).Error; err != nil {
+			return err
+		}
+		var err error
+		if photos, err = deleteReviews(tx, reviews); err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{
+			&models.InventoryReservation{},
+			&models.CartItem{},
+			&models.ProductRating{},
+			&models.ProductVariant{},
+		} {
+			if err := tx.Where("product_id = ?", product.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&product).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
 		return
 	}
+	deletePhotoBlobs(c.Request.Context(), h.blobs, photos)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
@@ -226,10 +355,164 @@ func (h *ProductHandler) GetSellerProducts(c *gin.Context) {
 	}
 
 	var products []models.Product
-	if err := config.GetDB().Where("seller_id = ?", userID).Order("created_at DESC").Find(&products).Error; err != nil {
+	if err := config.GetDB().Preload("Variants", orderVariants).Where("seller_id = ?", userID).Order("created_at DESC").Find(&products).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 		return
 	}
+	for i := range products {
+		setMinPrice(&products[i])
+	}
 
 	c.JSON(http.StatusOK, gin.H{"products": products})
 }
+
+// syncProductVariants makes the product's variants match the request: entries
+// with an ID update that variant, entries without one are created, and
+// existing variants missing from the list are deleted.
+func syncProductVariants(tx *gorm.DB, product *models.Product, requested []models.ProductVariantRequest) error {
+	var existing []models.ProductVariant
+	if err := tx.Where("product_id = ?", product.ID).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	byID := make(map[string]models.ProductVariant, len(existing))
+	for _, variant := range existing {
+		byID[variant.ID] = variant
+	}
+
+	skus := make(map[string]bool, len(requested))
+	for _, req := range requested {
+		if skus[req.SKU] {
+			return newRequestError(http.StatusBadRequest, fmt.Sprintf("Duplicate SKU %s", req.SKU))
+		}
+		skus[req.SKU] = true
+
+		if req.ID != "" {
+			if _, exists := byID[req.ID]; !exists {
+				return newRequestError(http.StatusNotFound, fmt.Sprintf("Variant %s not found", req.ID))
+			}
+		}
+
+		var clash models.ProductVariant
+		if err := tx.Where("sku = ? AND product_id <> ?", req.SKU, product.ID).First(&clash).Error; err == nil {
+			return newRequestError(http.StatusConflict, fmt.Sprintf("SKU %s is already in use", req.SKU))
+		}
+	}
+
+	kept := make(map[string]bool, len(requested))
+	for _, req := range requested {
+		if req.ID != "" {
+			kept[req.ID] = true
+		}
+	}
+
+	var removed []string
+	for _, variant := range existing {
+		if !kept[variant.ID] {
+			removed = append(removed, variant.ID)
+		}
+	}
+	if len(removed) > 0 {
+		// Holds on a removed variant lapse with it; there is no stock left
+		// to return them to. Units already committed to orders stay recorded.
+		if err := tx.Model(&models.InventoryReservation{}).
+			Where("product_id = ? AND variant_id IN ? AND status = ?", product.ID, removed, models.ReservationStatusActive).
+			Update("status", models.ReservationStatusReleased).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id = ? AND variant_id IN ?", product.ID, removed).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", removed).Delete(&models.ProductVariant{}).Error; err != nil {
+			return err
+		}
+	}
+
+	product.Variants = make([]models.ProductVariant, 0, len(requested))
+	for _, req := range requested {
+		var variant models.ProductVariant
+		if req.ID != "" {
+			// Stock is only written when sent, so editing a variant's details
+			// does not undo the reservations taken since it was read.
+			updates := map[string]interface{}{
+				"sku":     req.SKU,
+				"name":    req.Name,
+				"options": models.VariantOptions(req.Options),
+				"price":   req.Price,
+			}
+			variant = byID[req.ID]
+			if err := tx.Model(&variant).Updates(updates).Error; err != nil {
+				return err
+			}
+			if req.Stock != nil {
+				if err := setStock(tx, product.ID, variant.ID, *req.Stock); err != nil {
+					return err
+				}
+			}
+			if err := tx.Where("id = ?", req.ID).First(&variant).Error; err != nil {
+				return err
+			}
+		} else {
+			variant = models.ProductVariant{
+				ProductID: product.ID,
+				SKU:       req.SKU,
+				Name:      req.Name,
+				Options:   models.VariantOptions(req.Options),
+				Price:     req.Price,
+			}
+			if req.Stock != nil {
+				variant.Stock = *req.Stock
+			}
+			if err := tx.Create(&variant).Error; err != nil {
+				return err
+			}
+		}
+
+		product.Variants = append(product.Variants, variant)
+	}
+
+	return nil
+}
+
+func orderVariants(db *gorm.DB) *gorm.DB {
+	return db.Order("created_at ASC")
+}
+
+func setMinPrice(product *models.Product) {
+	product.MinPrice = product.Price
+	for i, variant := range product.Variants {
+		price := variant.EffectivePrice(product)
+		if i == 0 || price < product.MinPrice {
+			product.MinPrice = price
+		}
+	}
+}
+
+// resolveVariant loads the variant a buyer picked. Products that have
+// variants must be bought as one of them; products without variants are
+// bought as-is and return a nil variant.
+func resolveVariant(db *gorm.DB, product *models.Product, variantID string) (*models.ProductVariant, error) {
+	if variantID != "" {
+		var variant models.ProductVariant
+		if err := db.Where("id = ? AND product_id = ?", variantID, product.ID).First(&variant).Error; err != nil {
+			return nil, newRequestError(http.StatusNotFound, "Variant not found")
+		}
+		return &variant, nil
+	}
+
+	var count int64
+	if err := db.Model(&models.ProductVariant{}).Where("product_id = ?", product.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, newRequestError(http.StatusBadRequest, fmt.Sprintf("Please choose a variant of %s", product.Name))
+	}
+	return nil, nil
+}
+
+func unitPrice(product *models.Product, variant *models.ProductVariant) float64 {
+	if variant != nil {
+		return variant.EffectivePrice(product)
+	}
+	return product.Price
+}
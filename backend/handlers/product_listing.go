@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// productMinPriceSQL is the cheapest price a buyer can pay for a product:
+// the lowest effective variant price when the product has variants,
+// otherwise the product's own price.
+const productMinPriceSQL = "COALESCE((SELECT MIN(COALESCE(pv.price, products.price)) FROM product_variants pv WHERE pv.product_id = products.id), products.price)::float8"
+
+const productInStockSQL = "((products.stock > 0 AND NOT EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = products.id)) OR EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = products.id AND pv.stock > 0))"
+
+// productRatingSQL and productReviewCountSQL read the kept rating totals, a
+// primary key lookup, rather than the reviews.
+const productRatingSQL = "COALESCE((SELECT pr.rating_sum::float8 / NULLIF(pr.rating_count, 0) FROM product_ratings pr WHERE pr.product_id = products.id), 0)::float8"
+
+const productReviewCountSQL = "COALESCE((SELECT pr.rating_count FROM product_ratings pr WHERE pr.product_id = products.id), 0)"
+
+// productPopularitySQL counts units sold in orders that were not cancelled
+// or refunded.
+const productPopularitySQL = "(SELECT COALESCE(SUM(oi.quantity), 0) FROM order_items oi JOIN orders o ON o.id = oi.order_id WHERE oi.product_id = products.id AND o.status NOT IN ('cancelled', 'refunded'))"
+
+const productSearchRankSQL = "ts_rank(products.search_vector, search_query)"
+
+// productSortOrders are keyed by the sort query parameter. Sort keys are cast
+// to float8 where needed so the values read back into a cursor compare
+// exactly against the expression.
+var productSortOrders = map[string]keysetOrder{
+	"newest":     {name: "newest", keyExpr: "products.created_at", idColumn: "products.id", desc: true},
+	"price_asc":  {name: "price_asc", keyExpr: productMinPriceSQL, idColumn: "products.id", numeric: true},
+	"price_desc": {name: "price_desc", keyExpr: productMinPriceSQL, idColumn: "products.id", desc: true, numeric: true},
+	"rating":     {name: "rating", keyExpr: productRatingSQL, idColumn: "products.id", desc: true, numeric: true},
+	"popularity": {name: "popularity", keyExpr: productPopularitySQL, idColumn: "products.id", desc: true, numeric: true},
+	"relevance":  {name: "relevance", keyExpr: productSearchRankSQL, idColumn: "products.id", desc: true, numeric: true},
+}
+
+func productSortKey(order keysetOrder, product models.Product) interface{} {
+	switch order.name {
+	case "price_asc", "price_desc":
+		return product.MinPrice
+	case "rating":
+		return product.AverageRating
+	case "popularity":
+		return product.Popularity
+	case "relevance":
+		return product.SearchRank
+	default:
+		return product.CreatedAt
+	}
+}
+
+// productPriceBuckets are the upper bounds of the price facet buckets; the
+// last bucket is open-ended.
+var productPriceBuckets = []float64{50, 100, 250, 500, 1000}
+
+const (
+	facetCategory = "category"
+	facetSeller   = "seller"
+	facetPrice    = "price"
+)
+
+// Headlines are generated with placeholder delimiters and turned into <mark>
+// tags only after the seller-supplied text has been HTML-escaped.
+const (
+	headlineStart = "⟦"
+	headlineStop  = "⟧"
+)
+
+var productSearchColumns = ", " + productSearchRankSQL + " AS search_rank" +
+	", ts_headline('" + config.SearchConfig + "', products.name, search_query, 'HighlightAll=true, StartSel=" + headlineStart + ", StopSel=" + headlineStop + "') AS name_highlight" +
+	", ts_headline('" + config.SearchConfig + "', coalesce(products.description, ''), search_query, 'MaxFragments=2, MaxWords=25, MinWords=8, StartSel=" + headlineStart + ", StopSel=" + headlineStop + "') AS snippet"
+
+var headlineReplacer = strings.NewReplacer(headlineStart, "<mark>", headlineStop, "</mark>")
+
+func renderHeadline(headline string) string {
+	return headlineReplacer.Replace(html.EscapeString(headline))
+}
+
+type productFilter struct {
+	facet string
+	apply func(db *gorm.DB) *gorm.DB
+}
+
+// productListing is the parsed filter set and sort order of a product list
+// request. Each filter remembers which facet it belongs to so that a facet
+// can be counted with every filter except its own applied.
+type productListing struct {
+	search  string
+	filters []productFilter
+	order   keysetOrder
+}
+
+func parseProductListing(c *gin.Context) productListing {
+	var listing productListing
+
+	var categories []string
+	for _, value := range c.QueryArray("category") {
+		for _, category := range strings.Split(value, ",") {
+			if category = strings.TrimSpace(category); category != "" {
+				categories = append(categories, category)
+			}
+		}
+	}
+	if len(categories) > 0 {
+		listing.add(facetCategory, func(db *gorm.DB) *gorm.DB {
+			return db.Where("products.category IN ?", categories)
+		})
+	}
+
+	if sellerID := c.Query("seller_id"); sellerID != "" {
+		listing.add(facetSeller, func(db *gorm.DB) *gorm.DB {
+			return db.Where("products.seller_id = ?", sellerID)
+		})
+	}
+
+	listing.search = strings.TrimSpace(c.Query("search"))
+	if listing.search != "" {
+		search := listing.search
+		listing.add("", func(db *gorm.DB) *gorm.DB {
+			return db.
+				Joins("CROSS JOIN websearch_to_tsquery('"+config.SearchConfig+"', ?) AS search_query", search).
+				Where("products.search_vector @@ search_query")
+		})
+	}
+
+	if c.Query("in_stock") == "true" {
+		listing.add("", func(db *gorm.DB) *gorm.DB {
+			return db.Where(productInStockSQL)
+		})
+	}
+
+	if minPrice, err := strconv.ParseFloat(c.Query("min_price"), 64); err == nil {
+		listing.add(facetPrice, func(db *gorm.DB) *gorm.DB {
+			return db.Where(productMinPriceSQL+" >= ?", minPrice)
+		})
+	}
+
+	if maxPrice, err := strconv.ParseFloat(c.Query("max_price"), 64); err == nil {
+		listing.add(facetPrice, func(db *gorm.DB) *gorm.DB {
+			return db.Where(productMinPriceSQL+" <= ?", maxPrice)
+		})
+	}
+
+	if minRating, err := strconv.ParseFloat(c.Query("min_rating"), 64); err == nil && minRating > 0 {
+		listing.add("", func(db *gorm.DB) *gorm.DB {
+			return db.Where(productRatingSQL+" >= ?", minRating)
+		})
+	}
+
+	sort := c.Query("sort")
+	if sort == "" && listing.search != "" {
+		sort = "relevance"
+	}
+	if sort == "relevance" && listing.search == "" {
+		sort = "newest"
+	}
+	order, exists := productSortOrders[sort]
+	if !exists {
+		order = productSortOrders["newest"]
+	}
+	listing.order = order
+
+	return listing
+}
+
+func (l *productListing) add(facet string, apply func(db *gorm.DB) *gorm.DB) {
+	l.filters = append(l.filters, productFilter{facet: facet, apply: apply})
+}
+
+// query applies the listing's filters to db, leaving out the filters that
+// belong to skipFacet.
+func (l productListing) query(db *gorm.DB, skipFacet string) *gorm.DB {
+	query := db.Model(&models.Product{})
+	for _, filter := range l.filters {
+		if skipFacet != "" && filter.facet == skipFacet {
+			continue
+		}
+		query = filter.apply(query)
+	}
+	return query
+}
+
+func (l productListing) columns() string {
+	columns := "products.*" +
+		", " + productMinPriceSQL + " AS min_price" +
+		", " + productRatingSQL + " AS average_rating" +
+		", " + productReviewCountSQL + " AS review_count" +
+		", " + productPopularitySQL + " AS popularity"
+	if l.search != "" {
+		columns += productSearchColumns
+	}
+	return columns
+}
+
+func (l productListing) renderHeadlines(products []models.Product) {
+	if l.search == "" {
+		return
+	}
+	for i := range products {
+		products[i].NameHighlight = renderHeadline(products[i].NameHighlight)
+		products[i].Snippet = renderHeadline(products[i].Snippet)
+	}
+}
+
+// productFacets counts matching products per category, seller and price
+// bucket. Each facet is computed over the current filters minus the facet's
+// own, so picking one category still shows how many products the others have.
+func productFacets(db *gorm.DB, listing productListing) (*models.ProductFacets, error) {
+	facets := &models.ProductFacets{
+		Categories: []models.FacetCount{},
+		Sellers:    []models.FacetCount{},
+	}
+
+	if err := listing.query(db, facetCategory).
+		Select("products.category AS value, COUNT(*) AS count").
+		Group("products.category").
+		Order("count DESC, value ASC").
+		Scan(&facets.Categories).Error; err != nil {
+		return nil, err
+	}
+
+	if err := listing.query(db, facetSeller).
+		Select("products.seller_id AS value, MAX(products.seller_name) AS label, COUNT(*) AS count").
+		Group("products.seller_id").
+		Order("count DESC, label ASC").
+		Scan(&facets.Sellers).Error; err != nil {
+		return nil, err
+	}
+
+	var buckets []struct {
+		Bucket int
+		Count  int64
+	}
+	if err := listing.query(db, facetPrice).
+		Select(priceBucketSQL() + " AS bucket, COUNT(*) AS count").
+		Group("bucket").
+		Scan(&buckets).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int]int64, len(buckets))
+	for _, bucket := range buckets {
+		counts[bucket.Bucket] = bucket.Count
+	}
+
+	lower := 0.0
+	for i := 0; i <= len(productPriceBuckets); i++ {
+		bucket := models.PriceBucketCount{Min: lower, Count: counts[i]}
+		if i < len(productPriceBuckets) {
+			upper := productPriceBuckets[i]
+			bucket.Max = &upper
+			lower = upper
+		}
+		facets.Prices = append(facets.Prices, bucket)
+	}
+
+	return facets, nil
+}
+
+func priceBucketSQL() string {
+	var builder strings.Builder
+	builder.WriteString("CASE")
+	for i, bound := range productPriceBuckets {
+		fmt.Fprintf(&builder, " WHEN %s < %g THEN %d", productMinPriceSQL, bound, i)
+	}
+	fmt.Fprintf(&builder, " ELSE %d END", len(productPriceBuckets))
+	return builder.String()
+}
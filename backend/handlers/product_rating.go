@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"shopsphere-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// countedRating is how much a review adds to its product's rating totals:
+// its rating when published, otherwise nothing.
+func countedRating(review *models.Review) int {
+	if review.Status != models.ReviewStatusPublished {
+		return 0
+	}
+	return review.Rating
+}
+
+// adjustProductRating moves one review's contribution to a product's rating
+// totals from one rating to another, where 0 means not counted. The upsert
+// adds deltas rather than recounting, so concurrent reviews of a product
+// queue on its row instead of overwriting each other.
+func adjustProductRating(tx *gorm.DB, productID string, from, to int) error {
+	if from == to {
+		return nil
+	}
+
+	rating := productRatingDelta(productID, from, to)
+	rating.UpdatedAt = time.Now()
+
+	assignments := map[string]interface{}{"updated_at": gorm.Expr("EXCLUDED.updated_at")}
+	for _, column := range []string{"rating_count", "rating_sum", "stars_1", "stars_2", "stars_3", "stars_4", "stars_5"} {
+		assignments[column] = gorm.Expr(fmt.Sprintf("product_ratings.%s + EXCLUDED.%s", column, column))
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}},
+		DoUpdates: clause.Assignments(assignments),
+	}).Create(&rating).Error
+}
+
+// productRatingDelta is the change to a product's rating totals when one
+// review's counted rating moves from one value to another.
+func productRatingDelta(productID string, from, to int) models.ProductRating {
+	counted := func(rating int) int64 {
+		if rating > 0 {
+			return 1
+		}
+		return 0
+	}
+	stars := func(star int) int64 {
+		delta := int64(0)
+		if to == star {
+			delta++
+		}
+		if from == star {
+			delta--
+		}
+		return delta
+	}
+
+	return models.ProductRating{
+		ProductID:   productID,
+		RatingCount: counted(to) - counted(from),
+		RatingSum:   int64(to - from),
+		Stars1:      stars(1),
+		Stars2:      stars(2),
+		Stars3:      stars(3),
+		Stars4:      stars(4),
+		Stars5:      stars(5),
+	}
+}
+
+// productRatingTotals returns a product's rating totals. The kept totals
+// cover every published review; verifiedOnly counts the verified-purchase
+// ones on the spot instead.
+func productRatingTotals(db *gorm.DB, productID string, verifiedOnly bool) (*models.ProductRating, error) {
+	var totals models.ProductRating
+	var err error
+	if verifiedOnly {
+		err = db.Model(&models.Review{}).
+			Select(`COUNT(*) AS rating_count, COALESCE(SUM(rating), 0) AS rating_sum,
+				COUNT(*) FILTER (WHERE rating = 1) AS stars_1,
+				COUNT(*) FILTER (WHERE rating = 2) AS stars_2,
+				COUNT(*) FILTER (WHERE rating = 3) AS stars_3,
+				COUNT(*) FILTER (WHERE rating = 4) AS stars_4,
+				COUNT(*) FILTER (WHERE rating = 5) AS stars_5`).
+			Where("product_id = ? AND status = ? AND verified_purchase = ?", productID, models.ReviewStatusPublished, true).
+			Scan(&totals).Error
+	} else {
+		err = db.Where("product_id = ?", productID).Limit(1).Find(&totals).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	totals.ProductID = productID
+	return &totals, nil
+}
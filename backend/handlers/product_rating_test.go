@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"testing"
+
+	"shopsphere-backend/models"
+)
+
+func TestProductRatingDelta(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int
+		count    int64
+		sum      int64
+		stars    [5]int64
+	}{
+		{"published", 0, 5, 1, 5, [5]int64{0, 0, 0, 0, 1}},
+		{"withdrawn", 5, 0, -1, -5, [5]int64{0, 0, 0, 0, -1}},
+		{"raised", 3, 4, 0, 1, [5]int64{0, 0, -1, 1, 0}},
+		{"lowered", 4, 1, 0, -3, [5]int64{1, 0, 0, -1, 0}},
+		{"unchanged", 4, 4, 0, 0, [5]int64{}},
+		{"never counted", 0, 0, 0, 0, [5]int64{}},
+		{"hidden", 2, 0, -1, -2, [5]int64{0, -1, 0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := productRatingDelta("product-1", tt.from, tt.to)
+			if got.ProductID != "product-1" {
+				t.Errorf("got product %q", got.ProductID)
+			}
+			if got.RatingCount != tt.count || got.RatingSum != tt.sum {
+				t.Errorf("got count %d sum %d, want count %d sum %d", got.RatingCount, got.RatingSum, tt.count, tt.sum)
+			}
+			stars := [5]int64{got.Stars1, got.Stars2, got.Stars3, got.Stars4, got.Stars5}
+			if stars != tt.stars {
+				t.Errorf("got stars %v, want %v", stars, tt.stars)
+			}
+		})
+	}
+}
+
+func TestCountedRating(t *testing.T) {
+	tests := []struct {
+		status string
+		want   int
+	}{
+		{models.ReviewStatusPublished, 4},
+		{models.ReviewStatusPending, 0},
+		{models.ReviewStatusRejected, 0},
+	}
+
+	for _, tt := range tests {
+		review := models.Review{Rating: 4, Status: tt.status}
+		if got := countedRating(&review); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.status, got, tt.want)
+		}
+	}
+}
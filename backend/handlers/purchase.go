@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PurchaseVerifier decides whether a user has bought a product, which marks
+// their review of it as a verified purchase.
+type PurchaseVerifier interface {
+	HasPurchased(ctx context.Context, userID, productID string) (bool, error)
+}
+
+// ConfirmedPurchaseVerifier trusts the purchases table, which gains a row for
+// every line of an order once the seller ships it.
+type ConfirmedPurchaseVerifier struct{}
+
+func NewConfirmedPurchaseVerifier() *ConfirmedPurchaseVerifier {
+	return &ConfirmedPurchaseVerifier{}
+}
+
+func (v *ConfirmedPurchaseVerifier) HasPurchased(ctx context.Context, userID, productID string) (bool, error) {
+	var purchased bool
+	err := config.GetDB().WithContext(ctx).
+		Raw("SELECT EXISTS (SELECT 1 FROM purchases WHERE buyer_id = ? AND product_id = ?)", userID, productID).
+		Scan(&purchased).Error
+	return purchased, err
+}
+
+// recordPurchases confirms every line of a shipped order as a purchase and
+// verifies the buyer's reviews of those products written before it shipped.
+func recordPurchases(tx *gorm.DB, order *models.Order) error {
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", order.ID).Find(&items).Error; err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	purchases := make([]models.Purchase, len(items))
+	productIDs := make([]string, len(items))
+	for i, item := range items {
+		purchases[i] = models.Purchase{
+			BuyerID:     order.BuyerID,
+			ProductID:   item.ProductID,
+			OrderID:     order.ID,
+			OrderItemID: item.ID,
+			ConfirmedAt: now,
+		}
+		productIDs[i] = item.ProductID
+	}
+
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "order_item_id"}},
+		DoNothing: true,
+	}).Create(&purchases).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&models.Review{}).
+		Where("user_id = ? AND product_id IN ? AND NOT verified_purchase", order.BuyerID, productIDs).
+		UpdateColumn("verified_purchase", true).Error
+}
+
+// revokePurchases drops the purchases of a refunded order and unverifies the
+// buyer's reviews of products they no longer hold another purchase of.
+func revokePurchases(tx *gorm.DB, order *models.Order) error {
+	var productIDs []string
+	if err := tx.Model(&models.Purchase{}).Where("order_id = ?", order.ID).Distinct().Pluck("product_id", &productIDs).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("order_id = ?", order.ID).Delete(&models.Purchase{}).Error; err != nil {
+		return err
+	}
+	if len(productIDs) == 0 {
+		return nil
+	}
+
+	return tx.Model(&models.Review{}).
+		Where("user_id = ? AND product_id IN ? AND verified_purchase", order.BuyerID, productIDs).
+		Where("NOT EXISTS (SELECT 1 FROM purchases p WHERE p.buyer_id = reviews.user_id AND p.product_id = reviews.product_id)").
+		UpdateColumn("verified_purchase", false).Error
+}
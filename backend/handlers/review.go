@@ -7,19 +7,53 @@ import (
 	"shopsphere-backend/config"
 	"shopsphere-backend/middleware"
 	"shopsphere-backend/models"
+	"shopsphere-backend/moderation"
+	"shopsphere-backend/storage"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-type ReviewHandler struct{}
+type ReviewHandler struct {
+	verifier   PurchaseVerifier
+	filter     moderation.ContentFilter
+	moderation config.ReviewModerationConfig
+	blobs      storage.BlobStore
+}
+
+func NewReviewHandler(verifier PurchaseVerifier, filter moderation.ContentFilter, moderationConfig config.ReviewModerationConfig, blobs storage.BlobStore) *ReviewHandler {
+	return &ReviewHandler{verifier: verifier, filter: filter, moderation: moderationConfig, blobs: blobs}
+}
 
-func NewReviewHandler() *ReviewHandler {
-	return &ReviewHandler{}
+var reviewOrder = keysetOrder{name: "newest", keyExpr: "created_at", idColumn: "id", desc: true}
+
+// reviewSortOrders are the sort options of a product's reviews. helpful ranks
+// by the Wilson score of the helpfulness votes, so a review with a handful of
+// votes does not outrank one most of many voters found helpful.
+var reviewSortOrders = map[string]keysetOrder{
+	"newest":      reviewOrder,
+	"helpful":     {name: "helpful", keyExpr: "helpful_score", idColumn: "id", desc: true, numeric: true},
+	"rating_high": {name: "rating_high", keyExpr: "rating", idColumn: "id", desc: true, numeric: true},
+	"rating_low":  {name: "rating_low", keyExpr: "rating", idColumn: "id", numeric: true},
+}
+
+func reviewSortKey(order keysetOrder) func(models.Review) (interface{}, string) {
+	return func(review models.Review) (interface{}, string) {
+		switch order.name {
+		case "helpful":
+			return review.HelpfulScore, review.ID
+		case "rating_high", "rating_low":
+			return review.Rating, review.ID
+		default:
+			return review.CreatedAt, review.ID
+		}
+	}
 }
 
 func (h *ReviewHandler) GetReviews(c *gin.Context) {
 	var reviews []models.Review
-	query := config.GetDB()
+	query := config.GetDB().Where("status = ?", models.ReviewStatusPublished)
 
 	if productID := c.Query("product_id"); productID != "" {
 		query = query.Where("product_id = ?", productID)
@@ -35,25 +69,33 @@ func (h *ReviewHandler) GetReviews(c *gin.Context) {
 		}
 	}
 
-	page := 1
-	limit := 20
-	if p := c.Query("page"); p != "" {
-		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
-			page = parsed
-		}
+	cursor, cursorMode, err := cursorRequest(c, reviewOrder)
+	if err != nil {
+		respondWithError(c, err, "Failed to fetch reviews")
+		return
 	}
-	if l := c.Query("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
-			limit = parsed
+
+	if cursorMode {
+		limit := cursorLimit(c, 20)
+		if err := reviewOrder.apply(query, cursor).Preload("Photos", orderReviewPhotos).Limit(limit + 1).Find(&reviews).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+			return
 		}
+
+		reviews, pagination := keysetPage(reviews, limit, cursor, reviewOrder, func(review models.Review) (interface{}, string) {
+			return review.CreatedAt, review.ID
+		})
+		c.JSON(http.StatusOK, gin.H{"reviews": reviews, "pagination": pagination})
+		return
 	}
 
+	page, limit := offsetPage(c, 20)
 	offset := (page - 1) * limit
 
 	var total int64
 	query.Model(&models.Review{}).Count(&total)
 
-	if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&reviews).Error; err != nil {
+	if err := query.Preload("Photos", orderReviewPhotos).Offset(offset).Limit(limit).Order(reviewOrder.clause(false)).Find(&reviews).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
 		return
 	}
@@ -75,17 +117,26 @@ func (h *ReviewHandler) GetReview(c *gin.Context) {
 	reviewID := c.Param("id")
 
 	var review models.Review
-	if err := config.GetDB().Where("id = ?", reviewID).First(&review).Error; err != nil {
+	if err := config.GetDB().Preload("Reply").Preload("Photos", orderReviewPhotos).Where("id = ?", reviewID).First(&review).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
 		return
 	}
 
+	// Only the author and moderators see a review that is not published.
+	if review.Status != models.ReviewStatusPublished {
+		userID, _, role, _ := middleware.GetUserFromContext(c)
+		if review.UserID != userID && role != "moderator" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, review)
 }
 
 func (h *ReviewHandler) GetAllReviews(c *gin.Context) {
 	var reviews []models.Review
-	if err := config.GetDB().Where("true").Find(&reviews).Error; err != nil {
+	if err := config.GetDB().Preload("Photos", orderReviewPhotos).Where("status = ?", models.ReviewStatusPublished).Find(&reviews).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
 		return
 	}
@@ -106,25 +157,68 @@ func (h *ReviewHandler) GetProductReviews(c *gin.Context) {
 		return
 	}
 
-	var reviews []models.Review
-	if err := config.GetDB().Where("product_id = ?", productID).Order("created_at DESC").Find(&reviews).Error; err != nil {
+	order, valid := reviewSortOrders[c.DefaultQuery("sort", "newest")]
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sort must be one of helpful, newest, rating_high or rating_low"})
+		return
+	}
+
+	verifiedOnly := c.Query("verified") == "true"
+	productReviews := func() *gorm.DB {
+		query := config.GetDB().Model(&models.Review{}).Where("product_id = ? AND status = ?", productID, models.ReviewStatusPublished)
+		if verifiedOnly {
+			query = query.Where("verified_purchase = ?", true)
+		}
+		return query
+	}
+
+	totals, err := productRatingTotals(config.GetDB(), productID, verifiedOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+
+	verifiedReviews, err := countVerifiedReviews(productID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
 		return
 	}
 
-	var avgRating float64
-	if len(reviews) > 0 {
-		var totalRating int
-		for _, review := range reviews {
-			totalRating += review.Rating
+	cursor, cursorMode, err := cursorRequest(c, order)
+	if err != nil {
+		respondWithError(c, err, "Failed to fetch reviews")
+		return
+	}
+
+	var reviews []models.Review
+	var pagination gin.H
+	if cursorMode {
+		limit := cursorLimit(c, 20)
+		if err := order.apply(productReviews(), cursor).Preload("Reply").Preload("Photos", orderReviewPhotos).Limit(limit + 1).Find(&reviews).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+			return
+		}
+		reviews, pagination = keysetPage(reviews, limit, cursor, order, reviewSortKey(order))
+	} else {
+		page, limit := offsetPage(c, 20)
+		if err := productReviews().Preload("Reply").Preload("Photos", orderReviewPhotos).Order(order.clause(false)).Offset((page - 1) * limit).Limit(limit).Find(&reviews).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+			return
+		}
+		pagination = gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       totals.RatingCount,
+			"total_pages": (totals.RatingCount + int64(limit) - 1) / int64(limit),
 		}
-		avgRating = float64(totalRating) / float64(len(reviews))
 	}
 
 	response := gin.H{
-		"reviews":        reviews,
-		"total_reviews":  len(reviews),
-		"average_rating": avgRating,
+		"reviews":          reviews,
+		"pagination":       pagination,
+		"total_reviews":    totals.RatingCount,
+		"verified_reviews": verifiedReviews,
+		"average_rating":   totals.Average(),
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -149,22 +243,57 @@ func (h *ReviewHandler) CreateReview(c *gin.Context) {
 		return
 	}
 
-	var existingReview models.Review
-	if err := config.GetDB().Where("product_id = ? AND user_id = ?", req.ProductID, userID).First(&existingReview).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "You have already reviewed this product"})
+	if product.SellerID == userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot review your own product"})
 		return
 	}
 
-	review := models.Review{
-		ProductID: req.ProductID,
-		UserID:    userID,
-		UserName:  username,
-		Rating:    req.Rating,
-		Comment:   req.Comment,
+	verified, err := h.verifier.HasPurchased(c.Request.Context(), userID, req.ProductID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify purchase"})
+		return
 	}
 
-	if err := config.GetDB().Create(&review).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create review"})
+	verdict, err := h.filter.Check(c.Request.Context(), req.Comment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to screen review"})
+		return
+	}
+	status, action := screenedStatus(models.ReviewStatusPublished, verdict.Hold)
+
+	review := models.Review{
+		ProductID:        req.ProductID,
+		UserID:           userID,
+		UserName:         username,
+		Rating:           req.Rating,
+		Comment:          req.Comment,
+		VerifiedPurchase: verified,
+		Status:           status,
+	}
+
+	err = config.GetDB().Transaction(func(tx *gorm.DB) error {
+		// idx_reviews_product_user allows one review per product and user, so
+		// of two concurrent reviews only one is stored.
+		created := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "product_id"}, {Name: "user_id"}},
+			DoNothing: true,
+		}).Create(&review)
+		if created.Error != nil {
+			return created.Error
+		}
+		if created.RowsAffected == 0 {
+			return newRequestError(http.StatusConflict, "You have already reviewed this product")
+		}
+		if err := adjustProductRating(tx, review.ProductID, 0, countedRating(&review)); err != nil {
+			return err
+		}
+		if action == "" {
+			return nil
+		}
+		return recordReviewModeration(tx, review.ID, "", status, action, nil, "", verdict.Reason)
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to create review")
 		return
 	}
 
@@ -201,12 +330,48 @@ func (h *ReviewHandler) UpdateReview(c *gin.Context) {
 		return
 	}
 
-	review.Rating = req.Rating
-	review.Comment = req.Comment
-	review.UserName = username
+	verified, err := h.verifier.HasPurchased(c.Request.Context(), userID, review.ProductID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify purchase"})
+		return
+	}
 
-	if err := config.GetDB().Save(&review).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review"})
+	verdict, err := h.filter.Check(c.Request.Context(), req.Comment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to screen review"})
+		return
+	}
+
+	err = config.GetDB().Transaction(func(tx *gorm.DB) error {
+		// The row is read again under lock: a moderator may have rejected the
+		// review, or voters changed its counts, since it was loaded above.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", review.ID).First(&review).Error; err != nil {
+			return newRequestError(http.StatusNotFound, "Review not found")
+		}
+
+		previousStatus := review.Status
+		previousRating := countedRating(&review)
+		status, action := screenedStatus(review.Status, verdict.Hold)
+
+		review.Rating = req.Rating
+		review.Comment = req.Comment
+		review.UserName = username
+		review.VerifiedPurchase = verified
+		review.Status = status
+
+		if err := tx.Model(&review).Select("rating", "comment", "user_name", "verified_purchase", "status").Updates(&review).Error; err != nil {
+			return err
+		}
+		if err := adjustProductRating(tx, review.ProductID, previousRating, countedRating(&review)); err != nil {
+			return err
+		}
+		if action == "" {
+			return nil
+		}
+		return recordReviewModeration(tx, review.ID, previousStatus, status, action, nil, "", verdict.Reason)
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to update review")
 		return
 	}
 
@@ -233,14 +398,72 @@ func (h *ReviewHandler) DeleteReview(c *gin.Context) {
 		return
 	}
 
-	if err := config.GetDB().Delete(&review).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete review"})
+	var photos []models.ReviewPhoto
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		// The rating taken off the totals must be the one a concurrent
+		// moderation or edit left behind, so the row is read again under lock.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", review.ID).First(&review).Error; err != nil {
+			return newRequestError(http.StatusNotFound, "Review not found")
+		}
+
+		var err error
+		photos, err = deleteReviews(tx, []models.Review{review})
+		return err
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to delete review")
 		return
 	}
+	deletePhotoBlobs(c.Request.Context(), h.blobs, photos)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Review deleted successfully"})
 }
 
+// deleteReviews removes reviews, which the caller has locked, together with
+// their photos, votes, reply and reports, and takes them off their products'
+// rating totals. It returns the deleted photos, whose files the caller
+// removes with deletePhotoBlobs once the transaction has committed.
+func deleteReviews(tx *gorm.DB, reviews []models.Review) ([]models.ReviewPhoto, error) {
+	if len(reviews) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(reviews))
+	for i := range reviews {
+		ids[i] = reviews[i].ID
+	}
+
+	var photos []models.ReviewPhoto
+	if err := tx.Where("review_id IN ?", ids).Find(&photos).Error; err != nil {
+		return nil, err
+	}
+	for _, model := range []interface{}{
+		&models.ReviewPhoto{},
+		&models.ReviewVote{},
+		&models.ReviewReply{},
+		&models.ReviewReport{},
+	} {
+		if err := tx.Where("review_id IN ?", ids).Delete(model).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	result := tx.Where("id IN ?", ids).Delete(&models.Review{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected != int64(len(reviews)) {
+		return nil, newRequestError(http.StatusNotFound, "Review not found")
+	}
+
+	for i := range reviews {
+		if err := adjustProductRating(tx, reviews[i].ProductID, countedRating(&reviews[i]), 0); err != nil {
+			return nil, err
+		}
+	}
+	return photos, nil
+}
+
 func (h *ReviewHandler) GetUserReviews(c *gin.Context) {
 	userID, _, _, ok := middleware.GetUserFromContext(c)
 	if !ok {
@@ -249,7 +472,7 @@ func (h *ReviewHandler) GetUserReviews(c *gin.Context) {
 	}
 
 	var reviews []models.Review
-	if err := config.GetDB().Where("user_id = ?", userID).Order("created_at DESC").Find(&reviews).Error; err != nil {
+	if err := config.GetDB().Preload("Photos", orderReviewPhotos).Where("user_id = ?", userID).Order("created_at DESC").Find(&reviews).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
 		return
 	}
@@ -266,35 +489,28 @@ func (h *ReviewHandler) GetReviewStat(c *gin.Context) {
 		return
 	}
 
-	var stats struct {
-		TotalReviews       int         `json:"total_reviews"`
-		AverageRating      float64     `json:"average_rating"`
-		RatingDistribution map[int]int `json:"rating_distribution"`
-	}
-
-	var reviews []models.Review
-	if err := config.GetDB().Where("product_id = ?", productID).Find(&reviews).Error; err != nil {
+	totals, err := productRatingTotals(config.GetDB(), productID, c.Query("verified") == "true")
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch review statistics"})
 		return
 	}
 
-	stats.TotalReviews = len(reviews)
-	stats.RatingDistribution = make(map[int]int)
-
-	if len(reviews) > 0 {
-		var totalRating int
-		for _, review := range reviews {
-			totalRating += review.Rating
-			stats.RatingDistribution[review.Rating]++
-		}
-		stats.AverageRating = float64(totalRating) / float64(len(reviews))
+	verifiedReviews, err := countVerifiedReviews(productID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch review statistics"})
+		return
 	}
 
-	for i := 1; i <= 5; i++ {
-		if _, exists := stats.RatingDistribution[i]; !exists {
-			stats.RatingDistribution[i] = 0
-		}
-	}
+	c.JSON(http.StatusOK, gin.H{
+		"total_reviews":       totals.RatingCount,
+		"verified_reviews":    verifiedReviews,
+		"average_rating":      totals.Average(),
+		"rating_distribution": totals.Histogram(),
+	})
+}
 
-	c.JSON(http.StatusOK, stats)
+func countVerifiedReviews(productID string) (int64, error) {
+	var count int64
+	err := config.GetDB().Model(&models.Review{}).Where("product_id = ? AND verified_purchase = ? AND status = ?", productID, true, models.ReviewStatusPublished).Count(&count).Error
+	return count, err
 }
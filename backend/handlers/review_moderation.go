@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Actions recorded in a review's moderation history.
+const (
+	reviewActionHeld        = "held"
+	reviewActionResubmitted = "resubmitted"
+	reviewActionApproved    = "approved"
+	reviewActionRejected    = "rejected"
+)
+
+const reviewOpenReportsSQL = "(SELECT COUNT(*) FROM review_reports rr WHERE rr.review_id = reviews.id AND rr.resolved_at IS NULL)"
+
+// ReportReview files the caller's complaint about a published review. Enough
+// open reports send the review back to moderation.
+func (h *ReviewHandler) ReportReview(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var req models.ReviewReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		var review models.Review
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status = ?", c.Param("id"), models.ReviewStatusPublished).
+			First(&review).Error; err != nil {
+			return newRequestError(http.StatusNotFound, "Review not found")
+		}
+		if review.UserID == userID {
+			return newRequestError(http.StatusForbidden, "You cannot report your own review")
+		}
+
+		var reported int64
+		if err := tx.Model(&models.ReviewReport{}).Where("review_id = ? AND reporter_id = ?", review.ID, userID).Count(&reported).Error; err != nil {
+			return err
+		}
+		if reported > 0 {
+			return newRequestError(http.StatusConflict, "You have already reported this review")
+		}
+
+		report := models.ReviewReport{
+			ReviewID:   review.ID,
+			ReporterID: userID,
+			Reason:     req.Reason,
+			Details:    strings.TrimSpace(req.Details),
+		}
+		if err := tx.Create(&report).Error; err != nil {
+			return err
+		}
+
+		var open int64
+		if err := tx.Model(&models.ReviewReport{}).Where("review_id = ? AND resolved_at IS NULL", review.ID).Count(&open).Error; err != nil {
+			return err
+		}
+		if open < int64(h.moderation.ReportThreshold) {
+			return nil
+		}
+
+		return moderateReview(tx, &review, models.ReviewStatusPending, reviewActionHeld, nil, "", fmt.Sprintf("Reported by %d users", open))
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to report review")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Review reported"})
+}
+
+// GetModerationQueue lists reviews in one moderation status, pending by
+// default, oldest first with their open report counts.
+func (h *ReviewHandler) GetModerationQueue(c *gin.Context) {
+	status := c.DefaultQuery("status", models.ReviewStatusPending)
+	if status != models.ReviewStatusPending && status != models.ReviewStatusRejected && status != models.ReviewStatusPublished {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be one of pending, rejected or published"})
+		return
+	}
+
+	page, limit := offsetPage(c, 20)
+	query := config.GetDB().Model(&models.Review{}).Where("status = ?", status)
+	if c.Query("reported") == "true" {
+		query = query.Where(reviewOpenReportsSQL + " > 0")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch moderation queue"})
+		return
+	}
+
+	var reviews []models.Review
+	if err := query.Select("reviews.*, " + reviewOpenReportsSQL + " AS open_reports").
+		Order("created_at ASC, id ASC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&reviews).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch moderation queue"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reviews": reviews,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// GetModerationReview returns a review of any status with its reports and
+// moderation history.
+func (h *ReviewHandler) GetModerationReview(c *gin.Context) {
+	var review models.Review
+	if err := config.GetDB().Preload("Reply").Preload("Photos", orderReviewPhotos).Where("id = ?", c.Param("id")).First(&review).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+
+	var reports []models.ReviewReport
+	if err := config.GetDB().Where("review_id = ?", review.ID).Order("created_at ASC").Find(&reports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch review reports"})
+		return
+	}
+
+	var history []models.ReviewModerationEvent
+	if err := config.GetDB().Where("review_id = ?", review.ID).Order("id ASC").Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch moderation history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"review":  review,
+		"reports": reports,
+		"history": history,
+	})
+}
+
+// ApproveReview publishes a review, or keeps a published one up, and
+// dismisses its open reports.
+func (h *ReviewHandler) ApproveReview(c *gin.Context) {
+	h.decideReview(c, models.ReviewStatusPublished, reviewActionApproved)
+}
+
+// RejectReview hides a review from everyone but its author, who may edit it
+// to submit it again.
+func (h *ReviewHandler) RejectReview(c *gin.Context) {
+	h.decideReview(c, models.ReviewStatusRejected, reviewActionRejected)
+}
+
+func (h *ReviewHandler) decideReview(c *gin.Context, status, action string) {
+	userID, username, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var req models.ReviewModerationRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if status == models.ReviewStatusRejected && reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to reject a review"})
+		return
+	}
+
+	var review models.Review
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", c.Param("id")).First(&review).Error; err != nil {
+			return newRequestError(http.StatusNotFound, "Review not found")
+		}
+		if status == models.ReviewStatusRejected && review.Status == models.ReviewStatusRejected {
+			return newRequestError(http.StatusConflict, "Review is already rejected")
+		}
+
+		if err := tx.Model(&models.ReviewReport{}).
+			Where("review_id = ? AND resolved_at IS NULL", review.ID).
+			Update("resolved_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return moderateReview(tx, &review, status, action, &userID, username, reason)
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to moderate review")
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+// moderateReview moves a review to status and records why in its history.
+func moderateReview(tx *gorm.DB, review *models.Review, status, action string, actorID *string, actorName, reason string) error {
+	from := review.Status
+	if from != status {
+		previousRating := countedRating(review)
+		if err := tx.Model(review).UpdateColumn("status", status).Error; err != nil {
+			return err
+		}
+		review.Status = status
+		if err := adjustProductRating(tx, review.ProductID, previousRating, countedRating(review)); err != nil {
+			return err
+		}
+	}
+	return recordReviewModeration(tx, review.ID, from, status, action, actorID, actorName, reason)
+}
+
+func recordReviewModeration(tx *gorm.DB, reviewID, from, to, action string, actorID *string, actorName, reason string) error {
+	return tx.Create(&models.ReviewModerationEvent{
+		ReviewID:   reviewID,
+		Action:     action,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    actorID,
+		ActorName:  actorName,
+		Reason:     reason,
+	}).Error
+}
+
+// screenedStatus is the status of a review, currently in status current,
+// once its author has written text the filter judged: held text waits for a
+// moderator, and editing a rejected review submits it again. The action is
+// empty when nothing needs recording.
+func screenedStatus(current string, held bool) (string, string) {
+	switch {
+	case held:
+		return models.ReviewStatusPending, reviewActionHeld
+	case current == models.ReviewStatusRejected:
+		return models.ReviewStatusPending, reviewActionResubmitted
+	default:
+		return current, ""
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"testing"
+
+	"shopsphere-backend/models"
+)
+
+func TestScreenedStatus(t *testing.T) {
+	tests := []struct {
+		current    string
+		held       bool
+		wantStatus string
+		wantAction string
+	}{
+		{models.ReviewStatusPublished, false, models.ReviewStatusPublished, ""},
+		{models.ReviewStatusPublished, true, models.ReviewStatusPending, reviewActionHeld},
+		{models.ReviewStatusPending, false, models.ReviewStatusPending, ""},
+		{models.ReviewStatusPending, true, models.ReviewStatusPending, reviewActionHeld},
+		{models.ReviewStatusRejected, false, models.ReviewStatusPending, reviewActionResubmitted},
+		{models.ReviewStatusRejected, true, models.ReviewStatusPending, reviewActionHeld},
+	}
+
+	for _, tt := range tests {
+		status, action := screenedStatus(tt.current, tt.held)
+		if status != tt.wantStatus || action != tt.wantAction {
+			t.Errorf("screenedStatus(%s, %v) = %s, %q; want %s, %q", tt.current, tt.held, status, action, tt.wantStatus, tt.wantAction)
+		}
+	}
+}
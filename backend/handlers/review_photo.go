@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/media"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+	"shopsphere-backend/signedurl"
+	"shopsphere-backend/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	reviewPhotoMaxCount = 5
+	reviewPhotoMaxSize  = 10 << 20
+	reviewPhotoMaxSide  = 2048
+	reviewThumbnailSide = 320
+)
+
+// reviewPhotoTypes are the sniffed media types media.Decode can read.
+var reviewPhotoTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// UploadReviewPhoto adds a multipart "file" image to the caller's review.
+// The upload is decoded and re-encoded as a JPEG, with a thumbnail, so
+// nothing but its pixels is stored.
+func (h *ReviewHandler) UploadReviewPhoto(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var review models.Review
+	if err := config.GetDB().Where("id = ?", c.Param("id")).First(&review).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+	if review.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only add photos to your own reviews"})
+		return
+	}
+
+	// Checked again when the photo is saved; this spares decoding an image
+	// that could not be added anyway.
+	var photos int64
+	if err := config.GetDB().Model(&models.ReviewPhoto{}).Where("review_id = ?", review.ID).Count(&photos).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add photo"})
+		return
+	}
+	if photos >= reviewPhotoMaxCount {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A review can have at most %d photos", reviewPhotoMaxCount)})
+		return
+	}
+
+	// Leave room for the multipart framing around the file itself.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, reviewPhotoMaxSize+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return
+	}
+	if fileHeader.Size > reviewPhotoMaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+		return
+	}
+	if fileHeader.Size == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is empty"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	// The client's Content-Type header is ignored; only the bytes decide.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if !reviewPhotoTypes[mediaType] {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Photos must be JPEG, PNG or GIF images"})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	decoded, err := media.Decode(file)
+	if errors.Is(err, media.ErrTooLarge) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Image dimensions are too large"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Image could not be read"})
+		return
+	}
+	full, err := decoded.Encode(reviewPhotoMaxSide)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process image"})
+		return
+	}
+	thumbnail, err := decoded.Encode(reviewThumbnailSide)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process image"})
+		return
+	}
+
+	photo := models.ReviewPhoto{
+		ID:              uuid.New().String(),
+		ReviewID:        review.ID,
+		Width:           full.Width,
+		Height:          full.Height,
+		Size:            int64(len(full.Data)),
+		ThumbnailWidth:  thumbnail.Width,
+		ThumbnailHeight: thumbnail.Height,
+		ThumbnailSize:   int64(len(thumbnail.Data)),
+	}
+	photo.StorageKey = "reviews/" + review.ID + "/" + photo.ID + ".jpg"
+	photo.ThumbnailKey = "reviews/" + review.ID + "/" + photo.ID + "-thumb.jpg"
+
+	ctx := c.Request.Context()
+	if err := h.blobs.Put(ctx, photo.StorageKey, bytes.NewReader(full.Data), photo.Size, "image/jpeg"); err != nil {
+		log.Printf("Failed to store review photo: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store photo"})
+		return
+	}
+	if err := h.blobs.Put(ctx, photo.ThumbnailKey, bytes.NewReader(thumbnail.Data), photo.ThumbnailSize, "image/jpeg"); err != nil {
+		log.Printf("Failed to store review photo thumbnail: %v", err)
+		deletePhotoBlobs(ctx, h.blobs, []models.ReviewPhoto{photo})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store photo"})
+		return
+	}
+
+	err = config.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Locking the review serialises uploads to it, so the limit holds.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", review.ID).First(&review).Error; err != nil {
+			return newRequestError(http.StatusNotFound, "Review not found")
+		}
+
+		var existing struct {
+			Count        int64
+			LastPosition int
+		}
+		if err := tx.Model(&models.ReviewPhoto{}).
+			Select("COUNT(*) AS count, COALESCE(MAX(position), 0) AS last_position").
+			Where("review_id = ?", review.ID).
+			Scan(&existing).Error; err != nil {
+			return err
+		}
+		if existing.Count >= reviewPhotoMaxCount {
+			return newRequestError(http.StatusConflict, fmt.Sprintf("A review can have at most %d photos", reviewPhotoMaxCount))
+		}
+
+		photo.Position = existing.LastPosition + 1
+		if err := tx.Create(&photo).Error; err != nil {
+			return err
+		}
+
+		// No filter can read images, so a new photo goes through the same
+		// hold as flagged text unless photo holds are turned off.
+		status, action := screenedStatus(review.Status, h.moderation.HoldPhotos)
+		if action == "" {
+			return nil
+		}
+		return moderateReview(tx, &review, status, action, nil, "", "Photo added")
+	})
+	if err != nil {
+		deletePhotoBlobs(ctx, h.blobs, []models.ReviewPhoto{photo})
+		respondWithError(c, err, "Failed to add photo")
+		return
+	}
+
+	c.JSON(http.StatusCreated, photo)
+}
+
+func (h *ReviewHandler) DeleteReviewPhoto(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var review models.Review
+	if err := config.GetDB().Where("id = ?", c.Param("id")).First(&review).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+	if review.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only remove photos from your own reviews"})
+		return
+	}
+
+	var photo models.ReviewPhoto
+	if err := config.GetDB().Where("id = ? AND review_id = ?", c.Param("photo_id"), review.ID).First(&photo).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+		return
+	}
+
+	if err := config.GetDB().Delete(&photo).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete photo"})
+		return
+	}
+	deletePhotoBlobs(c.Request.Context(), h.blobs, []models.ReviewPhoto{photo})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Photo deleted successfully"})
+}
+
+// GetReviewPhoto serves a photo without authentication so it can be used in
+// an <img> tag. Photos of published reviews are public; the others need the
+// signed URL, which only goes out with reviews the caller may see.
+func (h *ReviewHandler) GetReviewPhoto(c *gin.Context) {
+	h.serveReviewPhoto(c, false)
+}
+
+func (h *ReviewHandler) GetReviewPhotoThumbnail(c *gin.Context) {
+	h.serveReviewPhoto(c, true)
+}
+
+func (h *ReviewHandler) serveReviewPhoto(c *gin.Context, thumbnail bool) {
+	var photo models.ReviewPhoto
+	if err := config.GetDB().Where("id = ?", c.Param("id")).First(&photo).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+		return
+	}
+
+	var review models.Review
+	if err := config.GetDB().Select("id", "status").Where("id = ?", photo.ReviewID).First(&review).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+		return
+	}
+	if review.Status != models.ReviewStatusPublished {
+		if err := signedurl.Verify(c.Request.URL.Path, c.Query("expires"), c.Query("signature")); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+			return
+		}
+	}
+
+	key, size := photo.StorageKey, photo.Size
+	if thumbnail {
+		key, size = photo.ThumbnailKey, photo.ThumbnailSize
+	}
+
+	body, err := h.blobs.Get(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch photo"})
+		return
+	}
+	defer body.Close()
+
+	// Not cached by shared caches: the review can still be taken down.
+	c.DataFromReader(http.StatusOK, size, "image/jpeg", body, map[string]string{
+		"Content-Disposition":    "inline",
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=3600",
+	})
+}
+
+// deletePhotoBlobs removes stored photos and thumbnails. Failures are only
+// logged: the rows are gone, so nothing refers to the files any more.
+func deletePhotoBlobs(ctx context.Context, blobs storage.BlobStore, photos []models.ReviewPhoto) {
+	for _, photo := range photos {
+		for _, key := range []string{photo.StorageKey, photo.ThumbnailKey} {
+			if err := blobs.Delete(ctx, key); err != nil {
+				log.Printf("Failed to delete review photo %s: %v", key, err)
+			}
+		}
+	}
+}
+
+func orderReviewPhotos(db *gorm.DB) *gorm.DB {
+	return db.Order("position ASC")
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+func (h *ReviewHandler) CreateReply(c *gin.Context) {
+	userID, username, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	comment, ok := bindReplyComment(c)
+	if !ok {
+		return
+	}
+
+	review, ok := findSellerReview(c, userID)
+	if !ok {
+		return
+	}
+	if review.Status != models.ReviewStatusPublished {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only published reviews can be replied to"})
+		return
+	}
+
+	reply := models.ReviewReply{
+		ReviewID:   review.ID,
+		SellerID:   userID,
+		SellerName: username,
+		Comment:    comment,
+	}
+
+	// review_id is unique, so of two concurrent replies only one is stored.
+	result := config.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "review_id"}},
+		DoNothing: true,
+	}).Create(&reply)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reply"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This review already has a reply"})
+		return
+	}
+
+	review.Reply = &reply
+	c.JSON(http.StatusCreated, review)
+}
+
+func (h *ReviewHandler) UpdateReply(c *gin.Context) {
+	userID, username, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	comment, ok := bindReplyComment(c)
+	if !ok {
+		return
+	}
+
+	review, ok := findSellerReview(c, userID)
+	if !ok {
+		return
+	}
+	if review.Reply == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reply not found"})
+		return
+	}
+
+	review.Reply.Comment = comment
+	review.Reply.SellerName = username
+	if err := config.GetDB().Save(review.Reply).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reply"})
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+func (h *ReviewHandler) DeleteReply(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	review, ok := findSellerReview(c, userID)
+	if !ok {
+		return
+	}
+	if review.Reply == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reply not found"})
+		return
+	}
+
+	if err := config.GetDB().Delete(review.Reply).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete reply"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reply deleted successfully"})
+}
+
+// GetReviewsAwaitingReply lists reviews of the seller's products that have
+// no reply yet, oldest first so the longest-waiting come first.
+func (h *ReviewHandler) GetReviewsAwaitingReply(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	page, limit := offsetPage(c, 20)
+
+	query := config.GetDB().Model(&models.Review{}).
+		Where("product_id IN (SELECT id::text FROM products WHERE seller_id = ?)", userID).
+		Where("status = ?", models.ReviewStatusPublished).
+		Where("NOT EXISTS (SELECT 1 FROM review_replies rr WHERE rr.review_id = reviews.id)")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+
+	var reviews []models.Review
+	if err := query.Order("created_at ASC, id ASC").Offset((page - 1) * limit).Limit(limit).Find(&reviews).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reviews": reviews,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+func bindReplyComment(c *gin.Context) (string, bool) {
+	var req models.ReviewReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+
+	comment := strings.TrimSpace(req.Comment)
+	if comment == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reply cannot be empty"})
+		return "", false
+	}
+	return comment, true
+}
+
+// findSellerReview loads the review named in the path, with its reply,
+// provided the caller sells the reviewed product.
+func findSellerReview(c *gin.Context, userID string) (*models.Review, bool) {
+	var review models.Review
+	if err := config.GetDB().Preload("Reply").Where("id = ?", c.Param("id")).First(&review).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return nil, false
+	}
+
+	var product models.Product
+	if err := config.GetDB().Where("id = ?", review.ProductID).First(&product).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return nil, false
+	}
+
+	if product.SellerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only reply to reviews of your own products"})
+		return nil, false
+	}
+
+	return &review, true
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+
+	"shopsphere-backend/config"
+	"shopsphere-backend/middleware"
+	"shopsphere-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// reviewWilsonZ is the z-score of a 95% confidence interval.
+const reviewWilsonZ = 1.96
+
+// VoteReview records, or changes, whether the caller found a review helpful.
+func (h *ReviewHandler) VoteReview(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var req models.ReviewVoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var review models.Review
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := lockVotableReview(tx, c.Param("id"), userID, &review); err != nil {
+			return err
+		}
+
+		vote := models.ReviewVote{ReviewID: review.ID, UserID: userID, Helpful: *req.Helpful}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "review_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"helpful", "updated_at"}),
+		}).Create(&vote).Error; err != nil {
+			return err
+		}
+
+		return refreshReviewVotes(tx, &review)
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to record vote")
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+func (h *ReviewHandler) RemoveReviewVote(c *gin.Context) {
+	userID, _, _, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	var review models.Review
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := lockVotableReview(tx, c.Param("id"), userID, &review); err != nil {
+			return err
+		}
+
+		if err := tx.Where("review_id = ? AND user_id = ?", review.ID, userID).Delete(&models.ReviewVote{}).Error; err != nil {
+			return err
+		}
+
+		return refreshReviewVotes(tx, &review)
+	})
+	if err != nil {
+		respondWithError(c, err, "Failed to remove vote")
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+// lockVotableReview loads the review for update, so concurrent votes on it
+// recount one after another.
+func lockVotableReview(tx *gorm.DB, reviewID, userID string, review *models.Review) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND status = ?", reviewID, models.ReviewStatusPublished).First(review).Error; err != nil {
+		return newRequestError(http.StatusNotFound, "Review not found")
+	}
+	if review.UserID == userID {
+		return newRequestError(http.StatusForbidden, "You cannot vote on your own review")
+	}
+	return nil
+}
+
+// refreshReviewVotes recounts a review's votes and its helpful ranking. It
+// leaves updated_at alone, which tracks edits by the author.
+func refreshReviewVotes(tx *gorm.DB, review *models.Review) error {
+	var counts struct {
+		Helpful   int
+		Unhelpful int
+	}
+	if err := tx.Model(&models.ReviewVote{}).
+		Select("COUNT(*) FILTER (WHERE helpful) AS helpful, COUNT(*) FILTER (WHERE NOT helpful) AS unhelpful").
+		Where("review_id = ?", review.ID).
+		Scan(&counts).Error; err != nil {
+		return err
+	}
+
+	review.HelpfulCount = counts.Helpful
+	review.UnhelpfulCount = counts.Unhelpful
+	review.HelpfulScore = wilsonLowerBound(counts.Helpful, counts.Helpful+counts.Unhelpful)
+
+	return tx.Model(review).UpdateColumns(map[string]interface{}{
+		"helpful_count":   review.HelpfulCount,
+		"unhelpful_count": review.UnhelpfulCount,
+		"helpful_score":   review.HelpfulScore,
+	}).Error
+}
+
+// wilsonLowerBound is the lower bound of the Wilson score interval for the
+// share of positive votes: a cautious estimate that grows more confident,
+// and so higher, as votes accumulate.
+func wilsonLowerBound(positive, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	n := float64(total)
+	p := float64(positive) / n
+	z2 := reviewWilsonZ * reviewWilsonZ
+	return (p + z2/(2*n) - reviewWilsonZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWilsonLowerBound(t *testing.T) {
+	tests := []struct {
+		positive, total int
+		want            float64
+	}{
+		{0, 0, 0},
+		{0, 5, 0},
+		{1, 1, 0.2065},
+		{3, 4, 0.3006},
+		{10, 10, 0.7225},
+		{50, 100, 0.4038},
+		{90, 100, 0.8256},
+	}
+
+	for _, tt := range tests {
+		if got := wilsonLowerBound(tt.positive, tt.total); math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("wilsonLowerBound(%d, %d) = %.4f, want %.4f", tt.positive, tt.total, got, tt.want)
+		}
+	}
+}
+
+// More votes at the same share make the estimate more confident, which is
+// what keeps a single helpful vote from outranking a well-liked review.
+func TestWilsonLowerBoundGrowsWithVotes(t *testing.T) {
+	previous := 0.0
+	for _, total := range []int{1, 5, 20, 100, 1000} {
+		got := wilsonLowerBound(total, total)
+		if got <= previous {
+			t.Errorf("%d of %d votes scored %.4f, not above %.4f", total, total, got, previous)
+		}
+		if got > 1 {
+			t.Errorf("%d of %d votes scored %.4f, above 1", total, total, got)
+		}
+		previous = got
+	}
+}
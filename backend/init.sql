@@ -7,6 +7,9 @@
 -- Enable UUID extension for generating UUIDs
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
+-- Enable unaccent for diacritic-insensitive product search (see config/search.go)
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
 -- Create a function to generate random UUIDs (alternative to uuid-ossp)
 CREATE OR REPLACE FUNCTION gen_random_uuid() RETURNS uuid AS $$
 BEGIN
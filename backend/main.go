@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"time"
 
+	"shopsphere-backend/broadcast"
 	"shopsphere-backend/config"
 	"shopsphere-backend/handlers"
 	"shopsphere-backend/middleware"
+	"shopsphere-backend/moderation"
+	"shopsphere-backend/payments"
+	"shopsphere-backend/storage"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -31,10 +37,50 @@ func main() {
 		AllowCredentials: false,
 	}))
 
+	paymentProvider, err := payments.NewProviderFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure payment provider:", err)
+	}
+
+	chatBroadcaster, err := broadcast.NewFromEnv(config.GetDatabaseConfig().DSN())
+	if err != nil {
+		log.Fatal("Failed to configure chat broadcaster:", err)
+	}
+	defer chatBroadcaster.Close()
+
+	blobStore, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure blob store:", err)
+	}
+
+	retentionPolicy, err := config.GetChatRetentionConfig()
+	if err != nil {
+		log.Fatal("Invalid chat retention policy:", err)
+	}
+
+	reviewFilter, err := moderation.NewFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure review filter:", err)
+	}
+
+	reviewModeration, err := config.GetReviewModerationConfig()
+	if err != nil {
+		log.Fatal("Invalid review moderation settings:", err)
+	}
+
 	authHandler := handlers.NewAuthHandler()
-	productHandler := handlers.NewProductHandler()
-	reviewHandler := handlers.NewReviewHandler()
-	chatHandler := handlers.NewChatHandler()
+	productHandler := handlers.NewProductHandler(blobStore)
+	reviewHandler := handlers.NewReviewHandler(handlers.NewConfirmedPurchaseVerifier(), reviewFilter, *reviewModeration, blobStore)
+	chatHandler := handlers.NewChatHandler(chatBroadcaster, blobStore)
+	cartHandler := handlers.NewCartHandler()
+	orderHandler := handlers.NewOrderHandler()
+	paymentHandler := handlers.NewPaymentHandler(paymentProvider)
+	inventoryHandler := handlers.NewInventoryHandler()
+
+	go handlers.RunReservationSweeper(context.Background(), time.Minute)
+	go chatHandler.RunPresenceHeartbeat(context.Background(), 30*time.Second)
+	go chatHandler.RunEventPruner(context.Background(), time.Hour)
+	go handlers.NewChatRetention(*retentionPolicy, blobStore).Run(context.Background(), time.Hour)
 
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -51,6 +97,16 @@ func main() {
 			auth.POST("/login", authHandler.Login)
 		}
 
+		v1.POST("/payments/webhook", paymentHandler.HandleWebhook)
+
+		// Browsers cannot set headers on a WebSocket handshake, so this route
+		// authenticates with a token query parameter instead of AuthMiddleware.
+		v1.GET("/chat/room/:id/ws", chatHandler.HandleWebSocket)
+
+		// Attachments are fetched by <img> tags and downloads, which cannot
+		// send the JWT; a link signed for the participant authorizes them instead.
+		v1.GET("/chat/attachments/:id", chatHandler.DownloadAttachment)
+
 		protected := v1.Group("/")
 		protected.Use(middleware.AuthMiddleware())
 		{
@@ -66,6 +122,7 @@ func main() {
 			{
 				products.GET("", productHandler.GetProducts)
 				products.GET("/:id", productHandler.GetProduct)
+				products.POST("/:id/contact-seller", chatHandler.ContactSeller)
 			}
 
 			sellerProducts := protected.Group("/products")
@@ -74,6 +131,7 @@ func main() {
 				sellerProducts.POST("", productHandler.CreateProduct)
 				sellerProducts.PUT("/:id", productHandler.UpdateProduct)
 				sellerProducts.DELETE("/:id", productHandler.DeleteProduct)
+				sellerProducts.PUT("/:id/stock", inventoryHandler.UpdateStock)
 				sellerProducts.GET("/seller/my-products", productHandler.GetSellerProducts)
 			}
 
@@ -86,18 +144,97 @@ func main() {
 				reviews.POST("", reviewHandler.CreateReview)
 				reviews.PUT("/:id", reviewHandler.UpdateReview)
 				reviews.DELETE("/:id", reviewHandler.DeleteReview)
+				reviews.POST("/:id/vote", reviewHandler.VoteReview)
+				reviews.DELETE("/:id/vote", reviewHandler.RemoveReviewVote)
+				reviews.POST("/:id/report", reviewHandler.ReportReview)
+				reviews.POST("/:id/photos", reviewHandler.UploadReviewPhoto)
+				reviews.DELETE("/:id/photos/:photo_id", reviewHandler.DeleteReviewPhoto)
 				reviews.GET("/user/my-reviews", reviewHandler.GetUserReviews)
 			}
 
+			sellerReviews := protected.Group("/reviews")
+			sellerReviews.Use(middleware.RequireSellerRole())
+			{
+				sellerReviews.POST("/:id/reply", reviewHandler.CreateReply)
+				sellerReviews.PUT("/:id/reply", reviewHandler.UpdateReply)
+				sellerReviews.DELETE("/:id/reply", reviewHandler.DeleteReply)
+				sellerReviews.GET("/seller/awaiting-reply", reviewHandler.GetReviewsAwaitingReply)
+			}
+
+			reviewModerators := protected.Group("/moderation/reviews")
+			reviewModerators.Use(middleware.RequireModeratorRole())
+			{
+				reviewModerators.GET("", reviewHandler.GetModerationQueue)
+				reviewModerators.GET("/:id", reviewHandler.GetModerationReview)
+				reviewModerators.POST("/:id/approve", reviewHandler.ApproveReview)
+				reviewModerators.POST("/:id/reject", reviewHandler.RejectReview)
+			}
+
+			cart := protected.Group("/cart")
+			{
+				cart.GET("", cartHandler.GetCart)
+				cart.POST("/items", cartHandler.AddItem)
+				cart.PUT("/items/:id", cartHandler.UpdateItem)
+				cart.DELETE("/items/:id", cartHandler.RemoveItem)
+				cart.DELETE("", cartHandler.ClearCart)
+			}
+
+			inventory := protected.Group("/inventory")
+			{
+				inventory.GET("/reservations", inventoryHandler.GetReservations)
+				inventory.POST("/reservations", inventoryHandler.CreateReservation)
+				inventory.POST("/reservations/:id/release", inventoryHandler.ReleaseReservation)
+			}
+
+			orders := protected.Group("/orders")
+			{
+				orders.POST("/checkout", orderHandler.Checkout)
+				orders.GET("", orderHandler.GetOrders)
+				orders.GET("/:id", orderHandler.GetOrder)
+				orders.POST("/:id/status", orderHandler.UpdateOrderStatus)
+				orders.POST("/:id/pay", paymentHandler.AuthorizePayment)
+				orders.GET("/:id/payments", paymentHandler.GetOrderPayments)
+			}
+
+			paymentRoutes := protected.Group("/payments")
+			{
+				paymentRoutes.GET("/:id", paymentHandler.GetPayment)
+				paymentRoutes.POST("/:id/capture", paymentHandler.CapturePayment)
+				paymentRoutes.POST("/:id/refund", paymentHandler.RefundPayment)
+			}
+
+			sellerOrders := protected.Group("/orders")
+			sellerOrders.Use(middleware.RequireSellerRole())
+			{
+				sellerOrders.GET("/seller/my-orders", orderHandler.GetSellerOrders)
+			}
+
 			chat := protected.Group("/chat")
 			{
 				chat.GET("/rooms", chatHandler.GetChatRooms)
 				chat.POST("/rooms", chatHandler.CreateChatRoom)
 				chat.GET("/room/:id", chatHandler.GetChatRoom)
 				chat.GET("/room/:id/messages", chatHandler.GetChatMessages)
+				chat.POST("/room/:id/read", chatHandler.MarkRoomRead)
+				chat.GET("/room/:id/presence", chatHandler.GetRoomPresence)
 				chat.POST("/messages", chatHandler.SendMessage)
+				chat.PUT("/messages/:id", chatHandler.EditMessage)
+				chat.DELETE("/messages/:id", chatHandler.DeleteMessage)
+				chat.GET("/messages/:id/history", chatHandler.GetMessageHistory)
+				chat.POST("/messages/:id/reactions", chatHandler.AddReaction)
+				chat.DELETE("/messages/:id/reactions/:emoji", chatHandler.RemoveReaction)
+				chat.POST("/room/:id/attachments", chatHandler.UploadAttachment)
+				chat.GET("/attachments/:id/link", chatHandler.GetAttachmentLink)
 				chat.DELETE("/room/:id/leave", chatHandler.LeaveChatRoom)
+				chat.GET("/search", chatHandler.SearchMessages)
+				chat.GET("/room/:id/export", chatHandler.ExportTranscript)
+				chat.GET("/room/:id/events", chatHandler.StreamEvents)
+				chat.POST("/room/:id/typing", chatHandler.SendTyping)
+				chat.PUT("/room/:id", chatHandler.RenameChatRoom)
 				chat.POST("/room/:id/participants", chatHandler.AddParticipant)
+				chat.DELETE("/room/:id/participants/:user_id", chatHandler.RemoveParticipant)
+				chat.PUT("/room/:id/participants/:user_id/mute", chatHandler.MuteParticipant)
+				chat.PUT("/room/:id/participants/:user_id/role", chatHandler.SetParticipantRole)
 			}
 		}
 	}
@@ -110,6 +247,8 @@ func main() {
 		public.GET("/product/:product_id", reviewHandler.GetProductReviews)
 		public.GET("/reviews/product/:product_id/stats", reviewHandler.GetReviewStat)
 		public.GET("/reviews", reviewHandler.GetAllReviews)
+		public.GET("/reviews/photos/:id", reviewHandler.GetReviewPhoto)
+		public.GET("/reviews/photos/:id/thumbnail", reviewHandler.GetReviewPhotoThumbnail)
 	}
 
 	port := os.Getenv("PORT")
@@ -0,0 +1,107 @@
+package media
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// exifSegment is an APP1 segment holding a TIFF structure whose first IFD
+// has just the orientation tag.
+func exifSegment(order binary.ByteOrder, orientation int) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], exifOrientationTag)
+	order.PutUint16(tiff[12:], 3) // SHORT
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], uint16(orientation))
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// withSegments puts segments right after the start-of-image marker.
+func withSegments(jpeg []byte, segments ...[]byte) []byte {
+	out := append([]byte{}, jpeg[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, jpeg[2:]...)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	soi := []byte{0xFF, 0xD8}
+	eoi := []byte{0xFF, 0xD9}
+	jfif := []byte{0xFF, 0xE0, 0x00, 0x07, 'J', 'F', 'I', 'F', 0}
+	minimal := append(append([]byte{}, soi...), eoi...)
+	exif := exifSegment(binary.BigEndian, 6)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"little endian", withSegments(minimal, exifSegment(binary.LittleEndian, 6)), 6},
+		{"big endian", withSegments(minimal, exifSegment(binary.BigEndian, 8)), 8},
+		{"after JFIF", withSegments(minimal, jfif, exifSegment(binary.LittleEndian, 3)), 3},
+		{"no EXIF", withSegments(minimal, jfif), 1},
+		{"out of range", withSegments(minimal, exifSegment(binary.LittleEndian, 9)), 1},
+		{"truncated", withSegments(minimal, exif)[:len(exif)-4], 1},
+		{"not a JPEG", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"empty", nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3×2 image whose top-left pixel is red:
+	//
+	//	R . .
+	//	. . .
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	red := color.RGBA{R: 0xff, A: 0xff}
+	src.Set(0, 0, red)
+
+	tests := []struct {
+		orientation   int
+		width, height int
+		redX, redY    int
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+	}
+
+	for _, tt := range tests {
+		dst := orient(src, tt.orientation)
+		if dst.Bounds().Dx() != tt.width || dst.Bounds().Dy() != tt.height {
+			t.Errorf("orientation %d: got %v, want %d×%d", tt.orientation, dst.Bounds(), tt.width, tt.height)
+			continue
+		}
+		if dst.RGBAAt(tt.redX, tt.redY) != red {
+			t.Errorf("orientation %d: red pixel is not at (%d, %d)", tt.orientation, tt.redX, tt.redY)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Package media turns untrusted uploaded images into clean JPEGs. Only the
+// decoded pixels survive re-encoding, so EXIF (camera, GPS position) and any
+// other metadata or trailing payload in the upload are dropped.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+
+	// Registered so image.Decode understands them.
+	_ "image/gif"
+	_ "image/png"
+)
+
+// MaxPixels bounds the decoded size of an upload, so a small, highly
+// compressed file cannot make the server allocate gigabytes.
+const MaxPixels = 24_000_000
+
+const jpegQuality = 85
+
+var (
+	ErrUnsupported = errors.New("unsupported image format")
+	ErrTooLarge    = errors.New("image dimensions are too large")
+)
+
+// Image is a re-encoded JPEG.
+type Image struct {
+	Data   []byte
+	Width  int
+	Height int
+}
+
+// Decoded is an upload flattened onto white and turned upright according to
+// its EXIF orientation, ready to be encoded at any size.
+type Decoded struct {
+	pixels *image.RGBA
+}
+
+// Decode reads a JPEG, PNG or GIF (its first frame).
+func Decode(r io.Reader) (*Decoded, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+
+	bounds := src.Bounds()
+	pixels := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(pixels, pixels.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(pixels, pixels.Bounds(), src, bounds.Min, draw.Over)
+
+	if format == "jpeg" {
+		pixels = orient(pixels, jpegOrientation(data))
+	}
+	return &Decoded{pixels: pixels}, nil
+}
+
+// Encode scales the image down, never up, to fit within maxSide pixels on
+// its longer side and encodes it as a JPEG.
+func (d *Decoded) Encode(maxSide int) (*Image, error) {
+	width, height := fit(d.pixels.Bounds().Dx(), d.pixels.Bounds().Dy(), maxSide)
+
+	scaled := d.pixels
+	if width != d.pixels.Bounds().Dx() || height != d.pixels.Bounds().Dy() {
+		scaled = resize(d.pixels, width, height)
+	}
+
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, scaled, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return &Image{Data: buffer.Bytes(), Width: width, Height: height}, nil
+}
+
+func fit(width, height, maxSide int) (int, int) {
+	if width <= maxSide && height <= maxSide {
+		return width, height
+	}
+	if width >= height {
+		return maxSide, max(1, height*maxSide/width)
+	}
+	return max(1, width*maxSide/height), maxSide
+}
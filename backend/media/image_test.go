@@ -0,0 +1,163 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// pngHeader is the start of a PNG claiming the given dimensions, which is
+// all image.DecodeConfig reads.
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	ihdr[12], ihdr[13] = 8, 6 // 8-bit RGBA
+
+	data := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d")
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"text", []byte("hello"), ErrUnsupported},
+		{"empty", nil, ErrUnsupported},
+		{"truncated PNG", pngHeader(10, 10), ErrUnsupported},
+		{"too many pixels", pngHeader(6000, 5000), ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(bytes.NewReader(tt.data)); !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecodeFlattensOntoWhite(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(1, 0, color.NRGBA{B: 0xff, A: 0xff})
+
+	decoded, err := Decode(bytes.NewReader(encodePNG(t, src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := decoded.pixels.RGBAAt(0, 0), (color.RGBA{0xff, 0xff, 0xff, 0xff}); got != want {
+		t.Errorf("transparent pixel: got %v, want %v", got, want)
+	}
+	if got, want := decoded.pixels.RGBAAt(1, 0), (color.RGBA{B: 0xff, A: 0xff}); got != want {
+		t.Errorf("opaque pixel: got %v, want %v", got, want)
+	}
+}
+
+func TestDecodeAppliesOrientation(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, 8, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := withSegments(buffer.Bytes(), exifSegment(binary.LittleEndian, 6))
+
+	decoded, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := decoded.pixels.Bounds(); bounds.Dx() != 4 || bounds.Dy() != 8 {
+		t.Errorf("got %v, want 4×8", bounds)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	decoded, err := Decode(bytes.NewReader(encodePNG(t, src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		maxSide       int
+		width, height int
+	}{
+		{100, 40, 20},
+		{40, 40, 20},
+		{10, 10, 5},
+	}
+
+	for _, tt := range tests {
+		out, err := decoded.Encode(tt.maxSide)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.Width != tt.width || out.Height != tt.height {
+			t.Errorf("max %d: got %d×%d, want %d×%d", tt.maxSide, out.Width, out.Height, tt.width, tt.height)
+		}
+		config, format, err := image.DecodeConfig(bytes.NewReader(out.Data))
+		if err != nil || format != "jpeg" || config.Width != tt.width || config.Height != tt.height {
+			t.Errorf("max %d: got %s %d×%d (%v)", tt.maxSide, format, config.Width, config.Height, err)
+		}
+		if strings.Contains(string(out.Data), "Exif") {
+			t.Errorf("max %d: output carries EXIF", tt.maxSide)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		width, height, maxSide int
+		wantWidth, wantHeight  int
+	}{
+		{800, 600, 1000, 800, 600},
+		{1000, 1000, 1000, 1000, 1000},
+		{4000, 3000, 1000, 1000, 750},
+		{3000, 4000, 1000, 750, 1000},
+		{5000, 2, 1000, 1000, 1},
+		{2, 5000, 1000, 1, 1000},
+	}
+
+	for _, tt := range tests {
+		width, height := fit(tt.width, tt.height, tt.maxSide)
+		if width != tt.wantWidth || height != tt.wantHeight {
+			t.Errorf("fit(%d, %d, %d) = %d×%d, want %d×%d", tt.width, tt.height, tt.maxSide, width, height, tt.wantWidth, tt.wantHeight)
+		}
+	}
+}
+
+func TestResizeAveragesArea(t *testing.T) {
+	// Alternating black and white columns average to mid grey.
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x += 2 {
+			src.Set(x, y, color.White)
+			src.Set(x+1, y, color.Black)
+		}
+	}
+
+	dst := resize(src, 2, 1)
+	for x := 0; x < 2; x++ {
+		if got := dst.RGBAAt(x, 0); got.R != 128 || got.G != 128 || got.B != 128 || got.A != 0xff {
+			t.Errorf("pixel %d: got %v, want mid grey", x, got)
+		}
+	}
+}
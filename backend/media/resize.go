@@ -0,0 +1,79 @@
+package media
+
+import "image"
+
+// contribution is how much of one source row or column lands in one output
+// row or column.
+type contribution struct {
+	index  int
+	weight float32
+}
+
+// areaWeights spreads srcLen source pixels over dstLen output pixels: each
+// output pixel averages the source pixels it covers, weighted by how much of
+// each it covers. For downscaling this is a box filter without aliasing.
+func areaWeights(srcLen, dstLen int) [][]contribution {
+	scale := float64(srcLen) / float64(dstLen)
+	weights := make([][]contribution, dstLen)
+	for i := range weights {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(start); j < srcLen && float64(j) < end; j++ {
+			covered := min(end, float64(j+1)) - max(start, float64(j))
+			if covered > 0 {
+				weights[i] = append(weights[i], contribution{index: j, weight: float32(covered / scale)})
+			}
+		}
+	}
+	return weights
+}
+
+// resize scales an opaque image to width × height, one axis at a time.
+func resize(src *image.RGBA, width, height int) *image.RGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	columns := areaWeights(srcWidth, width)
+	rows := areaWeights(srcHeight, height)
+
+	// Horizontal pass: srcHeight rows of width RGB pixels.
+	horizontal := make([]float32, srcHeight*width*3)
+	for y := 0; y < srcHeight; y++ {
+		line := src.Pix[y*src.Stride:]
+		out := horizontal[y*width*3:]
+		for x, column := range columns {
+			var r, g, b float32
+			for _, c := range column {
+				p := line[c.index*4:]
+				r += float32(p[0]) * c.weight
+				g += float32(p[1]) * c.weight
+				b += float32(p[2]) * c.weight
+			}
+			out[x*3], out[x*3+1], out[x*3+2] = r, g, b
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, row := range rows {
+		out := dst.Pix[y*dst.Stride:]
+		for x := 0; x < width; x++ {
+			var r, g, b float32
+			for _, c := range row {
+				p := horizontal[(c.index*width+x)*3:]
+				r += p[0] * c.weight
+				g += p[1] * c.weight
+				b += p[2] * c.weight
+			}
+			out[x*4], out[x*4+1], out[x*4+2], out[x*4+3] = clamp(r), clamp(g), clamp(b), 0xff
+		}
+	}
+	return dst
+}
+
+func clamp(v float32) uint8 {
+	v += 0.5
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
@@ -116,6 +116,10 @@ func RequireSellerRole() gin.HandlerFunc {
 	return RequireRole("seller")
 }
 
+func RequireModeratorRole() gin.HandlerFunc {
+	return RequireRole("moderator")
+}
+
 func GetUserFromContext(c *gin.Context) (string, string, string, bool) {
 	userID, exists1 := c.Get("user_id")
 	username, exists2 := c.Get("username")
@@ -1,8 +1,13 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"time"
 
+	"shopsphere-backend/signedurl"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -11,7 +16,7 @@ type User struct {
 	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
 	Username  string    `json:"username" gorm:"uniqueIndex;not null"`
 	Password  string    `json:"-" gorm:"not null"`
-	Role      string    `json:"role" gorm:"not null;check:role IN ('seller', 'customer')"`
+	Role      string    `json:"role" gorm:"not null;check:role IN ('seller', 'customer', 'moderator')"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -24,19 +29,28 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 }
 
 type Product struct {
-	ID          string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	Name        string    `json:"name" gorm:"not null"`
-	Description string    `json:"description" gorm:"type:text"`
-	Price       float64   `json:"price" gorm:"not null;check:price >= 0"`
-	ImageURL    string    `json:"imageUrl" gorm:"column:image_url"`
-	SellerID    string    `json:"sellerId" gorm:"column:seller_id;not null"`
-	SellerName  string    `json:"sellerName" gorm:"column:seller_name;not null"`
-	Category    string    `json:"category" gorm:"not null"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID            string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Name          string    `json:"name" gorm:"not null"`
+	Description   string    `json:"description" gorm:"type:text"`
+	Price         float64   `json:"price" gorm:"not null;check:price >= 0"`
+	ImageURL      string    `json:"imageUrl" gorm:"column:image_url"`
+	SellerID      string    `json:"sellerId" gorm:"column:seller_id;not null"`
+	SellerName    string    `json:"sellerName" gorm:"column:seller_name;not null"`
+	Category      string    `json:"category" gorm:"not null"`
+	Stock         int       `json:"stock" gorm:"not null;default:0;check:stock >= 0"`
+	MinPrice      float64   `json:"minPrice" gorm:"->;-:migration;column:min_price"`
+	AverageRating float64   `json:"averageRating" gorm:"->;-:migration;column:average_rating"`
+	ReviewCount   int64     `json:"reviewCount" gorm:"->;-:migration;column:review_count"`
+	Popularity    int64     `json:"-" gorm:"->;-:migration;column:popularity"`
+	SearchRank    float64   `json:"searchRank,omitempty" gorm:"->;-:migration;column:search_rank"`
+	NameHighlight string    `json:"nameHighlight,omitempty" gorm:"->;-:migration;column:name_highlight"`
+	Snippet       string    `json:"snippet,omitempty" gorm:"->;-:migration;column:snippet"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 
-	Seller  User     `json:"-" gorm:"foreignKey:SellerID;references:ID"`
-	Reviews []Review `json:"-" gorm:"foreignKey:ProductID;references:ID"`
+	Seller   User             `json:"-" gorm:"foreignKey:SellerID;references:ID"`
+	Reviews  []Review         `json:"-" gorm:"foreignKey:ProductID;references:ID"`
+	Variants []ProductVariant `json:"variants,omitempty" gorm:"foreignKey:ProductID;references:ID"`
 }
 
 func (p *Product) BeforeCreate(tx *gorm.DB) error {
@@ -46,18 +60,113 @@ func (p *Product) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
-type Review struct {
-	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	ProductID string    `json:"productId" gorm:"column:product_id;not null"`
-	UserID    string    `json:"userId" gorm:"column:user_id;not null"`
-	UserName  string    `json:"userName" gorm:"column:user_name;not null"`
-	Rating    int       `json:"rating" gorm:"not null;check:rating >= 1 AND rating <= 5"`
-	Comment   string    `json:"comment" gorm:"type:text"`
-	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+type VariantOptions map[string]string
+
+func (o VariantOptions) Value() (driver.Value, error) {
+	if o == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (o *VariantOptions) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*o = VariantOptions{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("unsupported type for VariantOptions")
+	}
+	return json.Unmarshal(data, o)
+}
+
+type ProductVariant struct {
+	ID        string         `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ProductID string         `json:"productId" gorm:"column:product_id;index;not null"`
+	SKU       string         `json:"sku" gorm:"column:sku;uniqueIndex;not null"`
+	Name      string         `json:"name"`
+	Options   VariantOptions `json:"options" gorm:"type:jsonb;not null;default:'{}'"`
+	Price     *float64       `json:"price,omitempty" gorm:"check:price IS NULL OR price >= 0"`
+	Stock     int            `json:"stock" gorm:"not null;default:0;check:stock >= 0"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
 
 	Product Product `json:"-" gorm:"foreignKey:ProductID;references:ID"`
-	User    User    `json:"-" gorm:"foreignKey:UserID;references:ID"`
+}
+
+func (v *ProductVariant) BeforeCreate(tx *gorm.DB) error {
+	if v.ID == "" {
+		v.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// EffectivePrice is what a buyer pays for this variant: its own price when
+// set, otherwise the parent product's price.
+func (v *ProductVariant) EffectivePrice(product *Product) float64 {
+	if v.Price != nil {
+		return *v.Price
+	}
+	return product.Price
+}
+
+// ProductRating holds running totals of a product's published reviews. They
+// change in the same transaction as the reviews, so listings can sort and
+// filter by rating without reading reviews.
+type ProductRating struct {
+	ProductID   string    `json:"productId" gorm:"column:product_id;primaryKey;type:uuid"`
+	RatingCount int64     `json:"ratingCount" gorm:"column:rating_count;not null;default:0"`
+	RatingSum   int64     `json:"ratingSum" gorm:"column:rating_sum;not null;default:0"`
+	Stars1      int64     `json:"stars1" gorm:"column:stars_1;not null;default:0"`
+	Stars2      int64     `json:"stars2" gorm:"column:stars_2;not null;default:0"`
+	Stars3      int64     `json:"stars3" gorm:"column:stars_3;not null;default:0"`
+	Stars4      int64     `json:"stars4" gorm:"column:stars_4;not null;default:0"`
+	Stars5      int64     `json:"stars5" gorm:"column:stars_5;not null;default:0"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+func (r *ProductRating) Average() float64 {
+	if r.RatingCount == 0 {
+		return 0
+	}
+	return float64(r.RatingSum) / float64(r.RatingCount)
+}
+
+// Histogram counts reviews per star rating, with every rating from 1 to 5
+// present.
+func (r *ProductRating) Histogram() map[int]int64 {
+	return map[int]int64{1: r.Stars1, 2: r.Stars2, 3: r.Stars3, 4: r.Stars4, 5: r.Stars5}
+}
+
+type Review struct {
+	ID               string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ProductID        string    `json:"productId" gorm:"column:product_id;not null;uniqueIndex:idx_reviews_product_user"`
+	UserID           string    `json:"userId" gorm:"column:user_id;not null;uniqueIndex:idx_reviews_product_user"`
+	UserName         string    `json:"userName" gorm:"column:user_name;not null"`
+	Rating           int       `json:"rating" gorm:"not null;check:rating >= 1 AND rating <= 5"`
+	Comment          string    `json:"comment" gorm:"type:text"`
+	VerifiedPurchase bool      `json:"verifiedPurchase" gorm:"column:verified_purchase;not null;default:false"`
+	HelpfulCount     int       `json:"helpfulCount" gorm:"column:helpful_count;not null;default:0"`
+	UnhelpfulCount   int       `json:"unhelpfulCount" gorm:"column:unhelpful_count;not null;default:0"`
+	HelpfulScore     float64   `json:"-" gorm:"column:helpful_score;not null;default:0;index"`
+	Status           string    `json:"status" gorm:"not null;default:'published';index;check:status IN ('published', 'pending', 'rejected')"`
+	OpenReports      int64     `json:"openReports,omitempty" gorm:"->;-:migration;column:open_reports"`
+	CreatedAt        time.Time `json:"createdAt" gorm:"column:created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+
+	Product Product       `json:"-" gorm:"foreignKey:ProductID;references:ID"`
+	User    User          `json:"-" gorm:"foreignKey:UserID;references:ID"`
+	Reply   *ReviewReply  `json:"reply,omitempty" gorm:"foreignKey:ReviewID;references:ID"`
+	Photos  []ReviewPhoto `json:"photos,omitempty" gorm:"foreignKey:ReviewID;references:ID"`
 }
 
 func (r *Review) BeforeCreate(tx *gorm.DB) error {
@@ -70,10 +179,135 @@ func (r *Review) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+const (
+	ReviewStatusPublished = "published"
+	ReviewStatusPending   = "pending"
+	ReviewStatusRejected  = "rejected"
+)
+
+// ReviewReply is the product seller's public answer to a review; a review
+// has at most one.
+type ReviewReply struct {
+	ID         string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ReviewID   string    `json:"reviewId" gorm:"column:review_id;type:uuid;not null;uniqueIndex"`
+	SellerID   string    `json:"sellerId" gorm:"column:seller_id;not null;index"`
+	SellerName string    `json:"sellerName" gorm:"column:seller_name;not null"`
+	Comment    string    `json:"comment" gorm:"type:text;not null"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+func (r *ReviewReply) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// ReviewPhoto is an image attached to a review, stored re-encoded as a JPEG
+// with a thumbnail next to it.
+type ReviewPhoto struct {
+	ID              string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ReviewID        string    `json:"reviewId" gorm:"column:review_id;type:uuid;not null;index"`
+	Position        int       `json:"position" gorm:"not null"`
+	Width           int       `json:"width" gorm:"not null"`
+	Height          int       `json:"height" gorm:"not null"`
+	Size            int64     `json:"size" gorm:"not null"`
+	ThumbnailWidth  int       `json:"thumbnailWidth" gorm:"column:thumbnail_width;not null"`
+	ThumbnailHeight int       `json:"thumbnailHeight" gorm:"column:thumbnail_height;not null"`
+	ThumbnailSize   int64     `json:"-" gorm:"column:thumbnail_size;not null"`
+	StorageKey      string    `json:"-" gorm:"column:storage_key;not null"`
+	ThumbnailKey    string    `json:"-" gorm:"column:thumbnail_key;not null"`
+	URL             string    `json:"url" gorm:"-"`
+	ThumbnailURL    string    `json:"thumbnailUrl" gorm:"-"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+func (p *ReviewPhoto) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
+
+func (p *ReviewPhoto) AfterCreate(tx *gorm.DB) error {
+	p.setURLs()
+	return nil
+}
+
+func (p *ReviewPhoto) AfterFind(tx *gorm.DB) error {
+	p.setURLs()
+	return nil
+}
+
+// setURLs signs the photo's URLs, which is what lets the author and
+// moderators see photos of reviews that are not published.
+func (p *ReviewPhoto) setURLs() {
+	path := "/api/v1/public/reviews/photos/" + p.ID
+	p.URL = signedurl.Sign(path)
+	p.ThumbnailURL = signedurl.Sign(path + "/thumbnail")
+}
+
+// ReviewReport is one user's complaint about a review. Reports stay open
+// until a moderator decides on the review.
+type ReviewReport struct {
+	ID         string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ReviewID   string     `json:"reviewId" gorm:"column:review_id;type:uuid;not null;uniqueIndex:idx_review_reports_review_reporter"`
+	ReporterID string     `json:"reporterId" gorm:"column:reporter_id;not null;uniqueIndex:idx_review_reports_review_reporter"`
+	Reason     string     `json:"reason" gorm:"not null;check:reason IN ('spam', 'offensive', 'off_topic', 'fake', 'other')"`
+	Details    string     `json:"details" gorm:"type:text"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ResolvedAt *time.Time `json:"resolvedAt"`
+}
+
+func (r *ReviewReport) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// ReviewModerationEvent is the audit trail of a review's status. ActorID is
+// empty when the content filter or the report threshold held the review.
+type ReviewModerationEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ReviewID   string    `json:"reviewId" gorm:"column:review_id;type:uuid;not null;index"`
+	Action     string    `json:"action" gorm:"not null"`
+	FromStatus string    `json:"fromStatus" gorm:"column:from_status"`
+	ToStatus   string    `json:"toStatus" gorm:"column:to_status;not null"`
+	ActorID    *string   `json:"actorId" gorm:"column:actor_id"`
+	ActorName  string    `json:"actorName" gorm:"column:actor_name"`
+	Reason     string    `json:"reason" gorm:"type:text"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// ReviewVote is one user's verdict on whether a review was helpful.
+type ReviewVote struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ReviewID  string    `json:"reviewId" gorm:"column:review_id;type:uuid;not null;uniqueIndex:idx_review_votes_review_user"`
+	UserID    string    `json:"userId" gorm:"column:user_id;not null;uniqueIndex:idx_review_votes_review_user"`
+	Helpful   bool      `json:"helpful" gorm:"not null"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Review Review `json:"-" gorm:"foreignKey:ReviewID;references:ID"`
+}
+
+const (
+	ChatRoleOwner  = "owner"
+	ChatRoleAdmin  = "admin"
+	ChatRoleMember = "member"
+)
+
+// ChatRoom.DirectKey identifies a direct room by its two participants and
+// product so the same conversation is never opened twice. Group rooms leave
+// it null.
 type ChatRoom struct {
 	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
 	Name      string    `json:"name" gorm:"not null"`
 	Type      string    `json:"type" gorm:"not null;check:type IN ('direct', 'group')"`
+	ProductID *string   `json:"product_id" gorm:"type:uuid;index"`
+	DirectKey *string   `json:"-" gorm:"uniqueIndex"`
 	CreatedBy string    `json:"created_by" gorm:"not null"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -91,35 +325,318 @@ func (c *ChatRoom) BeforeCreate(tx *gorm.DB) error {
 }
 
 type ChatRoomUser struct {
-	ID       uint      `json:"id" gorm:"primaryKey;autoIncrement"`
-	RoomID   string    `json:"room_id" gorm:"not null"`
-	UserID   string    `json:"user_id" gorm:"not null"`
-	JoinedAt time.Time `json:"joined_at" gorm:"default:CURRENT_TIMESTAMP"`
+	ID                uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	RoomID            string     `json:"room_id" gorm:"not null"`
+	UserID            string     `json:"user_id" gorm:"not null"`
+	JoinedAt          time.Time  `json:"joined_at" gorm:"default:CURRENT_TIMESTAMP"`
+	LastReadMessageID *string    `json:"last_read_message_id" gorm:"type:uuid"`
+	LastReadAt        *time.Time `json:"last_read_at"`
+	Role              string     `json:"role" gorm:"not null;default:'member';check:role IN ('owner', 'admin', 'member')"`
+	MutedUntil        *time.Time `json:"muted_until"`
 
 	Room ChatRoom `json:"-" gorm:"foreignKey:RoomID;references:ID"`
 	User User     `json:"-" gorm:"foreignKey:UserID;references:ID"`
 }
 
 type ChatMessage struct {
+	ID           string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	RoomID       string     `json:"room_id" gorm:"not null"`
+	UserID       string     `json:"user_id" gorm:"not null"`
+	UserName     string     `json:"user_name" gorm:"not null"`
+	Message      string     `json:"message" gorm:"type:text;not null"`
+	MessageType  string     `json:"message_type" gorm:"default:'text';check:message_type IN ('text', 'image', 'file', 'system')"`
+	AttachmentID *string    `json:"attachment_id,omitempty" gorm:"type:uuid"`
+	CreatedAt    time.Time  `json:"created_at"`
+	EditedAt     *time.Time `json:"edited_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty" gorm:"index"`
+
+	Room       ChatRoom            `json:"-" gorm:"foreignKey:RoomID;references:ID"`
+	User       User                `json:"-" gorm:"foreignKey:UserID;references:ID"`
+	Attachment *ChatAttachment     `json:"attachment,omitempty" gorm:"foreignKey:AttachmentID;references:ID"`
+	Reactions  []ChatReactionCount `json:"reactions,omitempty" gorm:"-"`
+
+	// Filled in by message search only.
+	RoomName string `json:"room_name,omitempty" gorm:"->;-:migration;column:room_name"`
+	Snippet  string `json:"snippet,omitempty" gorm:"->;-:migration;column:snippet"`
+}
+
+func (c *ChatMessage) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// ChatMessageRevision keeps the text a message had before each edit. The
+// revisions of a deleted message are removed along with its text.
+type ChatMessageRevision struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	MessageID string    `json:"message_id" gorm:"type:uuid;not null;index"`
+	Message   string    `json:"message" gorm:"type:text;not null"`
+	CreatedAt time.Time `json:"created_at"`
+
+	ChatMessage ChatMessage `json:"-" gorm:"foreignKey:MessageID;references:ID"`
+}
+
+type ChatMessageReaction struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	MessageID string    `json:"message_id" gorm:"type:uuid;not null;uniqueIndex:idx_chat_reactions_message_user_emoji"`
+	UserID    string    `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_chat_reactions_message_user_emoji"`
+	Emoji     string    `json:"emoji" gorm:"not null;uniqueIndex:idx_chat_reactions_message_user_emoji"`
+	CreatedAt time.Time `json:"created_at"`
+
+	ChatMessage ChatMessage `json:"-" gorm:"foreignKey:MessageID;references:ID"`
+	User        User        `json:"-" gorm:"foreignKey:UserID;references:ID"`
+}
+
+// ChatAttachment is a file uploaded to a chat room. The bytes live in the blob
+// store under StorageKey and are only served to the room's participants. URL
+// is a download link signed for the user a response is sent to; it is left
+// empty in events broadcast to the whole room.
+type ChatAttachment struct {
 	ID          string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	RoomID      string    `json:"room_id" gorm:"not null"`
-	UserID      string    `json:"user_id" gorm:"not null"`
-	UserName    string    `json:"user_name" gorm:"not null"`
-	Message     string    `json:"message" gorm:"type:text;not null"`
-	MessageType string    `json:"message_type" gorm:"default:'text';check:message_type IN ('text', 'image', 'file')"`
+	RoomID      string    `json:"room_id" gorm:"type:uuid;not null;index"`
+	UploadedBy  string    `json:"uploaded_by" gorm:"type:uuid;not null"`
+	FileName    string    `json:"file_name" gorm:"not null"`
+	ContentType string    `json:"content_type" gorm:"not null"`
+	Size        int64     `json:"size" gorm:"not null"`
+	StorageKey  string    `json:"-" gorm:"not null"`
+	URL         string    `json:"url,omitempty" gorm:"-"`
 	CreatedAt   time.Time `json:"created_at"`
+}
 
-	Room ChatRoom `json:"-" gorm:"foreignKey:RoomID;references:ID"`
-	User User     `json:"-" gorm:"foreignKey:UserID;references:ID"`
+func (a *ChatAttachment) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return nil
 }
 
-func (c *ChatMessage) BeforeCreate(tx *gorm.DB) error {
+// ChatPresence is one backend instance's view of a user's open WebSocket
+// connections. A row only counts as online while the instance keeps
+// refreshing LastSeenAt.
+type ChatPresence struct {
+	UserID      string    `json:"user_id" gorm:"primaryKey;type:uuid"`
+	InstanceID  string    `json:"instance_id" gorm:"primaryKey"`
+	Connections int       `json:"connections" gorm:"not null;default:0"`
+	LastSeenAt  time.Time `json:"last_seen_at" gorm:"not null;index"`
+}
+
+// ChatEventRecord keeps recent non-ephemeral chat events so event stream
+// clients can resume from Last-Event-ID. The sequential ID orders events
+// across instances, which is why it is not a UUID like other tables.
+type ChatEventRecord struct {
+	ID        int64     `json:"id" gorm:"primaryKey;autoIncrement;index:idx_chat_events_room_id_id,priority:2"`
+	RoomID    string    `json:"room_id" gorm:"type:uuid;not null;index:idx_chat_events_room_id_id,priority:1"`
+	Type      string    `json:"type" gorm:"not null"`
+	Payload   string    `json:"payload" gorm:"type:jsonb;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+func (ChatEventRecord) TableName() string {
+	return "chat_events"
+}
+
+type Cart struct {
+	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID    string    `json:"userId" gorm:"column:user_id;uniqueIndex;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	User  User       `json:"-" gorm:"foreignKey:UserID;references:ID"`
+	Items []CartItem `json:"-" gorm:"foreignKey:CartID;references:ID"`
+}
+
+func (c *Cart) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
+}
+
+type CartItem struct {
+	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	CartID    string    `json:"cartId" gorm:"column:cart_id;not null;uniqueIndex:idx_cart_items_cart_product_variant"`
+	ProductID string    `json:"productId" gorm:"column:product_id;not null;uniqueIndex:idx_cart_items_cart_product_variant"`
+	VariantID string    `json:"variantId,omitempty" gorm:"column:variant_id;not null;default:'';uniqueIndex:idx_cart_items_cart_product_variant"`
+	Quantity  int       `json:"quantity" gorm:"not null;check:quantity > 0"`
+	UnitPrice float64   `json:"unitPrice" gorm:"column:unit_price;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Cart    Cart    `json:"-" gorm:"foreignKey:CartID;references:ID"`
+	Product Product `json:"-" gorm:"foreignKey:ProductID;references:ID"`
+}
+
+func (c *CartItem) BeforeCreate(tx *gorm.DB) error {
 	if c.ID == "" {
 		c.ID = uuid.New().String()
 	}
 	return nil
 }
 
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusRefunded  = "refunded"
+)
+
+type Order struct {
+	ID         string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	CheckoutID string    `json:"checkoutId" gorm:"column:checkout_id;index;not null"`
+	BuyerID    string    `json:"buyerId" gorm:"column:buyer_id;index;not null"`
+	BuyerName  string    `json:"buyerName" gorm:"column:buyer_name;not null"`
+	SellerID   string    `json:"sellerId" gorm:"column:seller_id;index;not null"`
+	SellerName string    `json:"sellerName" gorm:"column:seller_name;not null"`
+	Status     string    `json:"status" gorm:"not null;default:'pending';check:status IN ('pending', 'paid', 'shipped', 'delivered', 'cancelled', 'refunded')"`
+	Total      float64   `json:"total" gorm:"not null;check:total >= 0"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	Buyer   User                 `json:"-" gorm:"foreignKey:BuyerID;references:ID"`
+	Seller  User                 `json:"-" gorm:"foreignKey:SellerID;references:ID"`
+	Items   []OrderItem          `json:"items,omitempty" gorm:"foreignKey:OrderID;references:ID"`
+	History []OrderStatusHistory `json:"history,omitempty" gorm:"foreignKey:OrderID;references:ID"`
+}
+
+func (o *Order) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == "" {
+		o.ID = uuid.New().String()
+	}
+	return nil
+}
+
+type OrderItem struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	OrderID     string    `json:"orderId" gorm:"column:order_id;index;not null"`
+	ProductID   string    `json:"productId" gorm:"column:product_id;not null"`
+	ProductName string    `json:"productName" gorm:"column:product_name;not null"`
+	VariantID   string    `json:"variantId,omitempty" gorm:"column:variant_id;not null;default:''"`
+	VariantName string    `json:"variantName,omitempty" gorm:"column:variant_name"`
+	SKU         string    `json:"sku,omitempty" gorm:"column:sku"`
+	SellerID    string    `json:"sellerId" gorm:"column:seller_id;not null"`
+	UnitPrice   float64   `json:"unitPrice" gorm:"column:unit_price;not null;check:unit_price >= 0"`
+	Quantity    int       `json:"quantity" gorm:"not null;check:quantity > 0"`
+	LineTotal   float64   `json:"lineTotal" gorm:"column:line_total;not null"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (o *OrderItem) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == "" {
+		o.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// Purchase is a line of an order the seller has shipped, which is what makes
+// the buyer's review of the product a verified purchase.
+type Purchase struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	BuyerID     string    `json:"buyerId" gorm:"column:buyer_id;not null;index:idx_purchases_buyer_product,priority:1"`
+	ProductID   string    `json:"productId" gorm:"column:product_id;not null;index:idx_purchases_buyer_product,priority:2"`
+	OrderID     string    `json:"orderId" gorm:"column:order_id;type:uuid;not null;index"`
+	OrderItemID string    `json:"orderItemId" gorm:"column:order_item_id;type:uuid;not null;uniqueIndex"`
+	ConfirmedAt time.Time `json:"confirmedAt" gorm:"column:confirmed_at;not null"`
+}
+
+func (p *Purchase) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
+
+type OrderStatusHistory struct {
+	ID         uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	OrderID    string    `json:"orderId" gorm:"column:order_id;index;not null"`
+	FromStatus string    `json:"fromStatus" gorm:"column:from_status"`
+	ToStatus   string    `json:"toStatus" gorm:"column:to_status;not null"`
+	ChangedBy  string    `json:"changedBy" gorm:"column:changed_by"`
+	Note       string    `json:"note" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
+
+const (
+	PaymentStatusPending    = "pending"
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusCaptured   = "captured"
+	PaymentStatusRefunded   = "refunded"
+	PaymentStatusFailed     = "failed"
+)
+
+type Payment struct {
+	ID             string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	OrderID        string    `json:"orderId" gorm:"column:order_id;index;not null;uniqueIndex:idx_payments_active_order,where:status <> 'refunded' AND status <> 'failed'"`
+	BuyerID        string    `json:"buyerId" gorm:"column:buyer_id;index;not null"`
+	SellerID       string    `json:"sellerId" gorm:"column:seller_id;index;not null"`
+	Amount         float64   `json:"amount" gorm:"not null;check:amount > 0"`
+	CapturedAmount float64   `json:"capturedAmount" gorm:"column:captured_amount;not null;default:0"`
+	RefundedAmount float64   `json:"refundedAmount" gorm:"column:refunded_amount;not null;default:0"`
+	Currency       string    `json:"currency" gorm:"not null;default:'PLN'"`
+	Provider       string    `json:"provider" gorm:"not null"`
+	ProviderRef    string    `json:"providerRef" gorm:"column:provider_ref;index"`
+	Status         string    `json:"status" gorm:"not null;default:'pending';check:status IN ('pending', 'authorized', 'captured', 'refunded', 'failed')"`
+	FailureReason  string    `json:"failureReason,omitempty" gorm:"column:failure_reason"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	Order  Order `json:"-" gorm:"foreignKey:OrderID;references:ID"`
+	Buyer  User  `json:"-" gorm:"foreignKey:BuyerID;references:ID"`
+	Seller User  `json:"-" gorm:"foreignKey:SellerID;references:ID"`
+}
+
+func (p *Payment) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
+
+type PaymentWebhookEvent struct {
+	ID         string    `json:"id" gorm:"primaryKey"`
+	Provider   string    `json:"provider" gorm:"not null"`
+	Type       string    `json:"type" gorm:"not null"`
+	PaymentID  string    `json:"paymentId" gorm:"column:payment_id"`
+	ReceivedAt time.Time `json:"receivedAt" gorm:"column:received_at;autoCreateTime"`
+}
+
+const (
+	ReservationStatusActive    = "active"
+	ReservationStatusCommitted = "committed"
+	ReservationStatusReleased  = "released"
+	ReservationStatusExpired   = "expired"
+)
+
+type InventoryReservation struct {
+	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ProductID string    `json:"productId" gorm:"column:product_id;index;not null"`
+	VariantID string    `json:"variantId,omitempty" gorm:"column:variant_id;not null;default:''"`
+	UserID    string    `json:"userId" gorm:"column:user_id;index;not null"`
+	OrderID   *string   `json:"orderId,omitempty" gorm:"column:order_id;index"`
+	Quantity  int       `json:"quantity" gorm:"not null;check:quantity > 0"`
+	Status    string    `json:"status" gorm:"not null;default:'active';index:idx_inventory_reservations_status_expiry;check:status IN ('active', 'committed', 'released', 'expired')"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"column:expires_at;not null;index:idx_inventory_reservations_status_expiry"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Product Product `json:"-" gorm:"foreignKey:ProductID;references:ID"`
+	User    User    `json:"-" gorm:"foreignKey:UserID;references:ID"`
+}
+
+func (r *InventoryReservation) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
+
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
@@ -142,6 +659,18 @@ type ProductRequest struct {
 	Price       float64 `json:"price" binding:"required,min=0"`
 	ImageURL    string  `json:"imageUrl"`
 	Category    string  `json:"category" binding:"required"`
+	Stock       *int    `json:"stock" binding:"omitempty,min=0"`
+
+	Variants []ProductVariantRequest `json:"variants" binding:"omitempty,dive"`
+}
+
+type ProductVariantRequest struct {
+	ID      string            `json:"id"`
+	SKU     string            `json:"sku" binding:"required,max=64"`
+	Name    string            `json:"name"`
+	Options map[string]string `json:"options"`
+	Price   *float64          `json:"price" binding:"omitempty,min=0"`
+	Stock   *int              `json:"stock" binding:"omitempty,min=0"`
 }
 
 type ReviewRequest struct {
@@ -152,6 +681,23 @@ type ReviewRequest struct {
 	Comment   string `json:"comment"`
 }
 
+type ReviewReplyRequest struct {
+	Comment string `json:"comment" binding:"required,max=2000"`
+}
+
+type ReviewReportRequest struct {
+	Reason  string `json:"reason" binding:"required,oneof=spam offensive off_topic fake other"`
+	Details string `json:"details" binding:"max=1000"`
+}
+
+type ReviewModerationRequest struct {
+	Reason string `json:"reason" binding:"max=1000"`
+}
+
+type ReviewVoteRequest struct {
+	Helpful *bool `json:"helpful" binding:"required"`
+}
+
 type ChatMessageRequest struct {
 	RoomID      string `json:"room_id" binding:"required"`
 	Message     string `json:"message" binding:"required"`
@@ -162,4 +708,210 @@ type CreateChatRoomRequest struct {
 	Name         string   `json:"name" binding:"required"`
 	Type         string   `json:"type" binding:"required,oneof=direct group"`
 	Participants []string `json:"participants" binding:"required,min=1"`
+	ProductID    string   `json:"product_id"`
+}
+
+type EditChatMessageRequest struct {
+	Message string `json:"message" binding:"required"`
+}
+
+type ChatReactionRequest struct {
+	Emoji string `json:"emoji" binding:"required"`
+}
+
+type ChatReactionCount struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	UserIDs []string `json:"user_ids"`
+}
+
+type ChatReactionEvent struct {
+	MessageID string              `json:"message_id"`
+	UserID    string              `json:"user_id"`
+	Emoji     string              `json:"emoji"`
+	Added     bool                `json:"added"`
+	Reactions []ChatReactionCount `json:"reactions"`
+}
+
+type AddParticipantRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+type RenameChatRoomRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// MuteParticipantRequest mutes for Minutes; zero unmutes.
+type MuteParticipantRequest struct {
+	Minutes int `json:"minutes" binding:"min=0,max=525600"`
+}
+
+type ChatRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin member"`
+}
+
+type MarkChatReadRequest struct {
+	MessageID string `json:"message_id"`
+}
+
+// ChatRetentionReport describes what a retention pass would purge.
+type ChatRetentionReport struct {
+	GeneratedAt time.Time                   `json:"generated_at"`
+	RoomTypes   []ChatRetentionRoomTypeStat `json:"room_types"`
+}
+
+type ChatRetentionRoomTypeStat struct {
+	RoomType        string     `json:"room_type"`
+	RetentionDays   int        `json:"retention_days"`
+	Cutoff          *time.Time `json:"cutoff"`
+	Messages        int64      `json:"messages"`
+	Rooms           int64      `json:"rooms"`
+	Attachments     int64      `json:"attachments"`
+	AttachmentBytes int64      `json:"attachment_bytes"`
+	OldestMessageAt *time.Time `json:"oldest_message_at"`
+}
+
+type ChatRoomSummary struct {
+	ChatRoom
+	UnreadCount       int64        `json:"unread_count"`
+	LastReadMessageID *string      `json:"last_read_message_id"`
+	LastMessage       *ChatMessage `json:"last_message"`
+}
+
+const (
+	ChatEventMessage  = "message"
+	ChatEventTyping   = "typing"
+	ChatEventPresence = "presence"
+	ChatEventReceipt  = "receipt"
+	ChatEventError    = "error"
+
+	ChatEventMessageEdited  = "message_edited"
+	ChatEventMessageDeleted = "message_deleted"
+	ChatEventReaction       = "reaction"
+
+	// ChatEventResync tells a resuming stream client that events were missed
+	// and it should reload the room over the REST API.
+	ChatEventResync = "resync"
+)
+
+// ChatEvent is the envelope of every frame the server sends over a chat
+// WebSocket; Data holds a ChatMessage (message, message_edited,
+// message_deleted), ChatTyping, ChatPresenceStatus, ChatReadReceipt,
+// ChatReactionEvent or ChatError depending on Type.
+type ChatEvent struct {
+	ID     int64       `json:"id,omitempty"`
+	Type   string      `json:"type"`
+	RoomID string      `json:"room_id"`
+	Data   interface{} `json:"data"`
+}
+
+// ChatClientEvent is the envelope of frames sent by clients. Data is decoded
+// according to Type: ChatMessageRequest, ChatTyping or MarkChatReadRequest.
+type ChatClientEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type ChatTyping struct {
+	UserID   string `json:"user_id"`
+	UserName string `json:"user_name"`
+	Typing   bool   `json:"typing"`
+}
+
+type ChatPresenceStatus struct {
+	UserID     string     `json:"user_id"`
+	UserName   string     `json:"user_name"`
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+}
+
+type ChatReadReceipt struct {
+	UserID    string    `json:"user_id"`
+	MessageID string    `json:"message_id"`
+	ReadAt    time.Time `json:"read_at"`
+}
+
+type ChatError struct {
+	Error string `json:"error"`
+}
+
+type CartItemRequest struct {
+	ProductID string `json:"productId" binding:"required"`
+	VariantID string `json:"variantId"`
+	Quantity  int    `json:"quantity" binding:"required,min=1,max=99"`
+}
+
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity" binding:"required,min=1,max=99"`
+}
+
+type CartLine struct {
+	ID           string  `json:"id"`
+	ProductID    string  `json:"productId"`
+	VariantID    string  `json:"variantId,omitempty"`
+	VariantName  string  `json:"variantName,omitempty"`
+	SKU          string  `json:"sku,omitempty"`
+	Name         string  `json:"name"`
+	ImageURL     string  `json:"imageUrl"`
+	SellerID     string  `json:"sellerId"`
+	SellerName   string  `json:"sellerName"`
+	Category     string  `json:"category"`
+	Quantity     int     `json:"quantity"`
+	Price        float64 `json:"price"`
+	AddedPrice   float64 `json:"addedPrice"`
+	PriceChanged bool    `json:"priceChanged"`
+	Available    bool    `json:"available"`
+	LineTotal    float64 `json:"lineTotal"`
+}
+
+type CartResponse struct {
+	ID              string     `json:"id"`
+	Items           []CartLine `json:"items"`
+	ItemCount       int        `json:"itemCount"`
+	Subtotal        float64    `json:"subtotal"`
+	HasPriceChanges bool       `json:"hasPriceChanges"`
+	HasUnavailable  bool       `json:"hasUnavailable"`
+}
+
+type CheckoutRequest struct {
+	Items              []CartItemRequest `json:"items" binding:"omitempty,dive"`
+	AcceptPriceChanges bool              `json:"acceptPriceChanges"`
+}
+
+type OrderStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=paid shipped delivered cancelled refunded"`
+	Note   string `json:"note"`
+}
+
+type RefundRequest struct {
+	Amount float64 `json:"amount" binding:"omitempty,gt=0"`
+}
+
+type ReservationRequest struct {
+	ProductID string `json:"productId" binding:"required"`
+	VariantID string `json:"variantId"`
+	Quantity  int    `json:"quantity" binding:"required,min=1,max=99"`
+}
+
+type StockRequest struct {
+	VariantID string `json:"variantId"`
+	Stock     *int   `json:"stock" binding:"required,min=0"`
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int64  `json:"count"`
+}
+
+type PriceBucketCount struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"`
+	Count int64    `json:"count"`
+}
+
+type ProductFacets struct {
+	Categories []FacetCount       `json:"categories"`
+	Sellers    []FacetCount       `json:"sellers"`
+	Prices     []PriceBucketCount `json:"prices"`
 }
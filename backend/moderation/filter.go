@@ -0,0 +1,93 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Verdict is a filter's decision on a piece of text. Held text waits for a
+// moderator instead of going live; Reason tells the moderator why.
+type Verdict struct {
+	Hold   bool
+	Reason string
+}
+
+// ContentFilter screens user-written text before it is published.
+type ContentFilter interface {
+	Check(ctx context.Context, text string) (Verdict, error)
+}
+
+// Chain runs filters in order and holds the text on the first one that does.
+type Chain []ContentFilter
+
+func (c Chain) Check(ctx context.Context, text string) (Verdict, error) {
+	for _, filter := range c {
+		verdict, err := filter.Check(ctx, text)
+		if err != nil || verdict.Hold {
+			return verdict, err
+		}
+	}
+	return Verdict{}, nil
+}
+
+// NewFromEnv builds the filter named by REVIEW_FILTER: default (the default)
+// chains a word list, from REVIEW_BLOCKED_WORDS and REVIEW_BLOCKED_WORDS_FILE,
+// with the spam heuristics; none publishes everything.
+func NewFromEnv() (ContentFilter, error) {
+	switch name := os.Getenv("REVIEW_FILTER"); name {
+	case "", "default":
+		words, err := blockedWordsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+
+		spam := DefaultSpamFilter()
+		if value := os.Getenv("REVIEW_MAX_LINKS"); value != "" {
+			maxLinks, err := strconv.Atoi(value)
+			if err != nil || maxLinks < 0 {
+				return nil, fmt.Errorf("REVIEW_MAX_LINKS must be a whole number")
+			}
+			spam.MaxLinks = maxLinks
+		}
+
+		return Chain{NewWordList(words), spam}, nil
+	case "none":
+		return Chain{}, nil
+	default:
+		return nil, fmt.Errorf("unknown review filter %q", name)
+	}
+}
+
+// blockedWordsFromEnv reads the comma-separated REVIEW_BLOCKED_WORDS and the
+// file named by REVIEW_BLOCKED_WORDS_FILE, one word per line with # comments.
+func blockedWordsFromEnv() ([]string, error) {
+	words := strings.Split(os.Getenv("REVIEW_BLOCKED_WORDS"), ",")
+
+	path := os.Getenv("REVIEW_BLOCKED_WORDS_FILE")
+	if path == "" {
+		return words, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read blocked words: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read blocked words: %w", err)
+	}
+	return words, nil
+}
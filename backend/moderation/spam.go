@@ -0,0 +1,85 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"unicode"
+)
+
+var (
+	linkPattern  = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+	emailPattern = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}\b`)
+)
+
+// SpamFilter holds text that looks like advertising or noise rather than a
+// review: too many links, contact details, long runs of one character or
+// text written mostly in capitals. A zero limit disables its check, except
+// MaxLinks, where zero allows no links at all.
+type SpamFilter struct {
+	MaxLinks       int
+	AllowEmails    bool
+	MaxRepeatedRun int
+	// MaxCapitalShare applies once the text has at least MinLettersForCaps
+	// letters, so short exclamations pass.
+	MaxCapitalShare   float64
+	MinLettersForCaps int
+}
+
+func DefaultSpamFilter() *SpamFilter {
+	return &SpamFilter{
+		MaxLinks:          1,
+		MaxRepeatedRun:    10,
+		MaxCapitalShare:   0.7,
+		MinLettersForCaps: 20,
+	}
+}
+
+func (f *SpamFilter) Check(ctx context.Context, text string) (Verdict, error) {
+	if links := len(linkPattern.FindAllString(text, -1)); links > f.MaxLinks {
+		return Verdict{Hold: true, Reason: fmt.Sprintf("Contains %d links", links)}, nil
+	}
+
+	if !f.AllowEmails && emailPattern.MatchString(text) {
+		return Verdict{Hold: true, Reason: "Contains an email address"}, nil
+	}
+
+	if f.MaxRepeatedRun > 0 && longestRun(text) > f.MaxRepeatedRun {
+		return Verdict{Hold: true, Reason: "Contains long runs of a repeated character"}, nil
+	}
+
+	if f.MaxCapitalShare > 0 {
+		letters, capitals := 0, 0
+		for _, r := range text {
+			if unicode.IsLetter(r) {
+				letters++
+				if unicode.IsUpper(r) {
+					capitals++
+				}
+			}
+		}
+		if letters >= f.MinLettersForCaps && float64(capitals)/float64(letters) > f.MaxCapitalShare {
+			return Verdict{Hold: true, Reason: "Written mostly in capital letters"}, nil
+		}
+	}
+
+	return Verdict{}, nil
+}
+
+// longestRun is the length of the longest run of one non-space character.
+func longestRun(text string) int {
+	longest, run := 0, 0
+	var previous rune
+	for _, r := range text {
+		if r == previous && !unicode.IsSpace(r) {
+			run++
+		} else {
+			run = 1
+		}
+		previous = r
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
@@ -0,0 +1,63 @@
+package moderation
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSpamFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter *SpamFilter
+		text   string
+		hold   bool
+	}{
+		{"ordinary review", DefaultSpamFilter(), "Arrived quickly and fits well. Would buy again.", false},
+		{"one link", DefaultSpamFilter(), "Manual at https://example.com/manual", false},
+		{"two links", DefaultSpamFilter(), "Buy at https://a.example and www.b.example", true},
+		{"no links allowed", &SpamFilter{}, "See www.example.com", true},
+		{"email", DefaultSpamFilter(), "Write to deals@example.com for a discount", true},
+		{"email allowed", &SpamFilter{AllowEmails: true}, "Write to deals@example.com", false},
+		{"repeated run", DefaultSpamFilter(), "Sooooooooooooo good", true},
+		{"run at the limit", DefaultSpamFilter(), "S" + strings.Repeat("o", 10) + " good", false},
+		{"spaces do not count as a run", DefaultSpamFilter(), "good" + strings.Repeat(" ", 30) + "stuff", false},
+		{"shouting", DefaultSpamFilter(), "THIS IS THE BEST PRODUCT I HAVE EVER BOUGHT", true},
+		{"short exclamation", DefaultSpamFilter(), "WOW! LOVE IT", false},
+		{"caps check off", &SpamFilter{MaxLinks: 1}, "THIS IS THE BEST PRODUCT I HAVE EVER BOUGHT", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, err := tt.filter.Check(context.Background(), tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verdict.Hold != tt.hold {
+				t.Errorf("held = %v, want %v (%s)", verdict.Hold, tt.hold, verdict.Reason)
+			}
+		})
+	}
+}
+
+func TestLongestRun(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abc", 1},
+		{"aab", 2},
+		{"baaab", 3},
+		{"!!!!", 4},
+		{"a   b", 1},
+		{"ąąą", 3},
+	}
+
+	for _, tt := range tests {
+		if got := longestRun(tt.text); got != tt.want {
+			t.Errorf("longestRun(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// WordList holds text containing any of its words or phrases. Matching
+// ignores case and punctuation but respects word boundaries, so "ass" does
+// not hold "class".
+type WordList struct {
+	phrases []string
+}
+
+func NewWordList(words []string) *WordList {
+	list := &WordList{}
+	for _, word := range words {
+		if phrase := normalizeWords(word); phrase != "" {
+			list.phrases = append(list.phrases, phrase)
+		}
+	}
+	return list
+}
+
+func (l *WordList) Check(ctx context.Context, text string) (Verdict, error) {
+	normalized := " " + normalizeWords(text) + " "
+	for _, phrase := range l.phrases {
+		if strings.Contains(normalized, " "+phrase+" ") {
+			return Verdict{Hold: true, Reason: fmt.Sprintf("Contains blocked word %q", phrase)}, nil
+		}
+	}
+	return Verdict{}, nil
+}
+
+// normalizeWords lowercases text and joins its words with single spaces.
+func normalizeWords(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
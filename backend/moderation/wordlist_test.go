@@ -0,0 +1,59 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWordList(t *testing.T) {
+	list := NewWordList([]string{"scam", "Fake Product", "  ", "ass"})
+
+	tests := []struct {
+		text string
+		hold bool
+	}{
+		{"Great value, works as described.", false},
+		{"This is a SCAM!", true},
+		{"scam", true},
+		{"Total scam-artist seller", true},
+		{"Scammers everywhere", false},
+		{"It's a fake product.", true},
+		{"It's a fake, product arrived broken", true},
+		{"Fake\nproduct", true},
+		{"fakeproduct", false},
+		{"First class service", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		verdict, err := list.Check(context.Background(), tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if verdict.Hold != tt.hold {
+			t.Errorf("Check(%q) held = %v, want %v (%s)", tt.text, verdict.Hold, tt.hold, verdict.Reason)
+		}
+		if verdict.Hold && verdict.Reason == "" {
+			t.Errorf("Check(%q) held without a reason", tt.text)
+		}
+	}
+}
+
+func TestNormalizeWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Hello, World!", "hello world"},
+		{"  spaced\tout \n", "spaced out"},
+		{"Zażółć gęślą", "zażółć gęślą"},
+		{"v2.0", "v2 0"},
+		{"...", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeWords(tt.text); got != tt.want {
+			t.Errorf("normalizeWords(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+const (
+	EventPaymentAuthorized = "payment.authorized"
+	EventPaymentCaptured   = "payment.captured"
+	EventPaymentRefunded   = "payment.refunded"
+	EventPaymentFailed     = "payment.failed"
+)
+
+var (
+	ErrDeclined         = errors.New("payment declined")
+	ErrUnknownReference = errors.New("unknown payment reference")
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// Amounts crossing the provider boundary are in minor units (grosze, cents)
+// so providers never have to deal with float rounding.
+type AuthorizeRequest struct {
+	PaymentID string
+	OrderID   string
+	BuyerID   string
+	SellerID  string
+	Amount    int64
+	Currency  string
+}
+
+type Result struct {
+	ProviderRef string
+	Amount      int64
+}
+
+type WebhookEvent struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	ProviderRef string `json:"provider_ref"`
+	Amount      int64  `json:"amount"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type PaymentProvider interface {
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error)
+	Capture(ctx context.Context, providerRef string, amount int64) (*Result, error)
+	Refund(ctx context.Context, providerRef string, amount int64) (*Result, error)
+	VerifyWebhook(payload []byte, signature string) (*WebhookEvent, error)
+}
+
+// NewProviderFromEnv builds the provider named by PAYMENT_PROVIDER. Only the
+// in-process fake exists for now; real PSPs plug in here.
+func NewProviderFromEnv() (PaymentProvider, error) {
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if secret == "" {
+		return nil, errors.New("PAYMENT_WEBHOOK_SECRET is not set")
+	}
+
+	switch name := os.Getenv("PAYMENT_PROVIDER"); name {
+	case "", "fake":
+		return NewFakeProvider(secret), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
+}
+
+func ToMinorUnits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func FromMinorUnits(amount int64) float64 {
+	return float64(amount) / 100
+}
@@ -0,0 +1,79 @@
+package signedurl
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// params splits a signed link into its path and query.
+func params(t *testing.T, link string) (string, url.Values) {
+	t.Helper()
+	path, rawQuery, _ := strings.Cut(link, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, query
+}
+
+func TestVerify(t *testing.T) {
+	path, query := params(t, Sign("/api/v1/reviews/photos/1"))
+
+	tests := []struct {
+		name          string
+		path, expires string
+		signature     string
+		want          error
+	}{
+		{"valid", path, query.Get("expires"), query.Get("signature"), nil},
+		{"other path", "/api/v1/reviews/photos/2", query.Get("expires"), query.Get("signature"), ErrInvalidSignature},
+		{"later expiry", path, "99999999999", query.Get("signature"), ErrInvalidSignature},
+		{"bad expiry", path, "soon", query.Get("signature"), ErrInvalidSignature},
+		{"no signature", path, query.Get("expires"), "", ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.path, tt.expires, tt.signature); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyFor(t *testing.T) {
+	path, query := params(t, SignFor("/api/v1/chat/attachments/1", "user-1", time.Minute))
+	_, expired := params(t, SignFor("/api/v1/chat/attachments/1", "user-1", -time.Minute))
+
+	tests := []struct {
+		name                string
+		path, user, expires string
+		signature           string
+		want                error
+	}{
+		{"valid", path, "user-1", query.Get("expires"), query.Get("signature"), nil},
+		{"other user", path, "user-2", query.Get("expires"), query.Get("signature"), ErrInvalidSignature},
+		{"no user", path, "", query.Get("expires"), query.Get("signature"), ErrInvalidSignature},
+		{"other path", "/api/v1/chat/attachments/2", "user-1", query.Get("expires"), query.Get("signature"), ErrInvalidSignature},
+		{"expired", path, "user-1", expired.Get("expires"), expired.Get("signature"), ErrExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyFor(tt.path, tt.user, tt.expires, tt.signature); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if query.Get("user") != "user-1" {
+		t.Errorf("got user parameter %q, want user-1", query.Get("user"))
+	}
+	// A link signed for a user is not a plain signed link.
+	if err := Verify(path, query.Get("expires"), query.Get("signature")); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify accepted a per-user link: %v", err)
+	}
+}